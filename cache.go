@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	cacheDirName     = "cache"
+	stateKeyFilename = "state.key"
+	stateKeySize     = 32
+
+	// Cached credentials closer than this to expiring are not reused
+	defaultCacheMinRemaining = 15 * time.Minute
+)
+
+// How a command is allowed to use cached credentials
+type cacheMode int
+
+const (
+	// Reuse cached credentials and store new ones
+	cacheEnabled cacheMode = iota
+	// Ignore cached credentials but store new ones
+	cacheRefresh
+	// Neither read nor write the cache
+	cacheDisabled
+)
+
+// Return the cache mode selected by the no-cache and refresh flags
+func newCacheMode(noCache, refresh bool) cacheMode {
+	switch {
+	case noCache:
+		return cacheDisabled
+	case refresh:
+		return cacheRefresh
+	}
+
+	return cacheEnabled
+}
+
+// Settings that change the credentials issued for an alias
+type cacheKeyInput struct {
+	Alias       string
+	RoleArn     string
+	MFADeviceID string
+
+	// Session names are rendered from the template and reason unless set
+	SessionName     string
+	SessionTemplate string
+	Reason          string
+
+	Duration int
+	Policy   string
+	Tags     map[string]string
+}
+
+// Return the key identifying credentials issued for an alias
+func credentialCacheKey(input cacheKeyInput) string {
+	tagKeys := make([]string, 0, len(input.Tags))
+	for k := range input.Tags {
+		tagKeys = append(tagKeys, k)
+	}
+	sort.Strings(tagKeys)
+
+	parts := []string{
+		input.Alias,
+		input.RoleArn,
+		input.MFADeviceID,
+		input.SessionName,
+		input.SessionTemplate,
+		input.Reason,
+		strconv.Itoa(input.Duration),
+		input.Policy,
+	}
+	for _, k := range tagKeys {
+		parts = append(parts, k+"="+input.Tags[k])
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Load the key used to encrypt local state, creating it on first use. The
+// key is stored beside the state, so it keeps files unreadable when copied
+// on their own but not from anyone who can read the state directory.
+func loadStateKey(dir string) ([]byte, error) {
+	path := filepath.Join(dir, stateKeyFilename)
+
+	key, err := ioutil.ReadFile(path)
+	if err == nil {
+		if len(key) != stateKeySize {
+			return nil, fmt.Errorf("%s is not a valid state key", path)
+		}
+		return key, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key = make([]byte, stateKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(path, key, 0600); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// Decrypt and decode a file written by writeSealed, reporting false if the
+// file does not exist
+func readSealed(path string, key []byte, v interface{}) (bool, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return false, err
+	}
+
+	if len(b) < gcm.NonceSize() {
+		return false, fmt.Errorf("%s is truncated", path)
+	}
+
+	plain, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return false, fmt.Errorf("unable to decrypt %s: %s", path, err)
+	}
+
+	return true, json.Unmarshal(plain, v)
+}
+
+// Encode and encrypt v to a file readable only by the current user
+func writeSealed(path string, key []byte, v interface{}) error {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	// Write then rename so readers never see a partial file
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(gcm.Seal(nonce, nonce, plain, nil)); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// Store of assumed-role credentials under the config directory
+type credentialCache struct {
+	dir          string
+	key          []byte
+	minRemaining time.Duration
+}
+
+func openCredentialCache(stateDir string, minRemaining time.Duration) (*credentialCache, error) {
+	key, err := loadStateKey(stateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if minRemaining == 0 {
+		minRemaining = defaultCacheMinRemaining
+	}
+
+	return &credentialCache{
+		dir:          filepath.Join(stateDir, cacheDirName),
+		key:          key,
+		minRemaining: minRemaining,
+	}, nil
+}
+
+// Return cached credentials for the key, or nil if none are usable
+func (c *credentialCache) Get(key string) (*sessionCredentials, error) {
+	var creds sessionCredentials
+
+	// Unreadable entries, such as those written with a replaced key, are
+	// treated as misses and overwritten by the next Put
+	found, err := readSealed(c.path(key), c.key, &creds)
+	if err != nil || !found {
+		return nil, nil
+	}
+
+	if creds.expiresWithin(c.minRemaining) {
+		return nil, nil
+	}
+
+	return &creds, nil
+}
+
+func (c *credentialCache) Put(key string, creds *sessionCredentials) error {
+	return writeSealed(c.path(key), c.key, creds)
+}
+
+func (c *credentialCache) path(key string) string {
+	return filepath.Join(c.dir, key)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCredentialCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cache, err := openCredentialCache(dir, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := credentialCacheKey(cacheKeyInput{Alias: "sandbox", RoleArn: roleARN("123456789012", "admin")})
+	creds := &sessionCredentials{
+		AccessKeyID:     "ASIAEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+
+	if err := cache.Put(key, creds); err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := cache.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cached == nil || cached.SessionToken != creds.SessionToken || !cached.Expiration.Equal(creds.Expiration) {
+		t.Errorf("expected %+v but got %+v", creds, cached)
+	}
+
+	b, err := ioutil.ReadFile(cache.path(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(b) == 0 || bytes.Contains(b, []byte("secret")) {
+		t.Error("expected cached credentials to be encrypted")
+	}
+
+	creds.Expiration = time.Now().Add(30 * time.Second)
+	if err := cache.Put(key, creds); err != nil {
+		t.Fatal(err)
+	}
+
+	if cached, _ := cache.Get(key); cached != nil {
+		t.Error("expected credentials near expiry to be ignored")
+	}
+}
+
+func TestCredentialCacheKey(t *testing.T) {
+	input := cacheKeyInput{
+		Alias:   "sandbox",
+		RoleArn: roleARN("123456789012", "admin"),
+		Tags:    map[string]string{"a": "1", "b": "2"},
+	}
+	first := credentialCacheKey(input)
+
+	input.Tags = map[string]string{"b": "2", "a": "1"}
+	if first != credentialCacheKey(input) {
+		t.Error("expected tag order to not change the key")
+	}
+
+	input.Policy = `{"Version":"2012-10-17"}`
+	if first == credentialCacheKey(input) {
+		t.Error("expected the session policy to change the key")
+	}
+}
+
+func TestCredentialCacheKey_mfaDevice(t *testing.T) {
+	input := cacheKeyInput{Alias: "sandbox", RoleArn: roleARN("123456789012", "admin")}
+
+	input.MFADeviceID = "arn:aws:iam::123456789012:mfa/phone"
+	phone := credentialCacheKey(input)
+
+	input.MFADeviceID = "arn:aws:iam::123456789012:mfa/yubikey"
+	if phone == credentialCacheKey(input) {
+		t.Error("expected credentials from different MFA devices to use different keys")
+	}
+}
+
+func TestRoleCredentialsInput_cacheKey(t *testing.T) {
+	input := roleCredentialsInput{
+		AccountName: "sandbox",
+		RoleArn:     roleARN("123456789012", "admin"),
+		SessionName: "deploy",
+		Duration:    3600,
+	}
+	key := input.cacheKey()
+
+	renamed := input
+	renamed.SessionName = "audit"
+	if key == renamed.cacheKey() {
+		t.Error("expected the session name to change the key")
+	}
+
+	longer := input
+	longer.Duration = 28800
+	if key == longer.cacheKey() {
+		t.Error("expected the duration to change the key")
+	}
+
+	// The saml command picks the session name and duration
+	input.SAML, longer.SAML = true, true
+	if input.cacheKey() != longer.cacheKey() {
+		t.Error("expected saml aliases to ignore the duration")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// MFA token codes are only accepted within about one time-step of the AWS
+// clock, well before SigV4 rejects signatures after 5 minutes
+const maxClockSkew = 30 * time.Second
+
+// Offset of the local clock from the last response carrying a Date header
+var clockSkew struct {
+	sync.Mutex
+	offset time.Duration
+	known  bool
+}
+
+// Return how far the local clock was ahead of the Date header when the
+// response was received. The header only has seconds so the offset is
+// rounded to them.
+func clockOffset(date string, received time.Time) (time.Duration, error) {
+	server, err := http.ParseTime(date)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Date header %q", date)
+	}
+
+	return received.Truncate(time.Second).Sub(server), nil
+}
+
+// Remember the clock offset from a response's Date header
+func recordClockSkew(header http.Header, received time.Time) {
+	offset, err := clockOffset(header.Get("Date"), received)
+	if err != nil {
+		return
+	}
+
+	clockSkew.Lock()
+	defer clockSkew.Unlock()
+	clockSkew.offset, clockSkew.known = offset, true
+}
+
+// Return the last recorded clock offset, false when no response had one
+func observedClockSkew() (time.Duration, bool) {
+	clockSkew.Lock()
+	defer clockSkew.Unlock()
+	return clockSkew.offset, clockSkew.known
+}
+
+// Report whether the offset is large enough to break MFA or signing
+func clockSkewed(offset time.Duration) bool {
+	return offset > maxClockSkew || offset < -maxClockSkew
+}
+
+// Describe an offset as ahead of or behind AWS
+func formatClockSkew(offset time.Duration) string {
+	if offset < 0 {
+		return fmt.Sprintf("%s behind AWS", -offset)
+	}
+
+	return fmt.Sprintf("%s ahead of AWS", offset)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestClockOffset(t *testing.T) {
+	received := time.Date(2018, 7, 1, 12, 0, 0, 500, time.UTC)
+
+	offset, err := clockOffset("Sun, 01 Jul 2018 11:58:30 GMT", received)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if offset != 90*time.Second || !clockSkewed(offset) {
+		t.Errorf("expected a skewed 90s offset but got %s", offset)
+	}
+
+	if formatClockSkew(-offset) != "1m30s behind AWS" {
+		t.Errorf("unexpected description %s", formatClockSkew(-offset))
+	}
+
+	if _, err := clockOffset("", received); err == nil {
+		t.Error("expected error for a missing Date header")
+	}
+}
+
+func TestDiagnoseClockSkew(t *testing.T) {
+	defer recordClockSkew(http.Header{"Date": {time.Now().UTC().Format(http.TimeFormat)}}, time.Now())
+
+	signature := awserr.New("SignatureDoesNotMatch", "Signature expired", nil)
+	recordClockSkew(http.Header{"Date": {time.Now().UTC().Format(http.TimeFormat)}}, time.Now().Add(5*time.Minute))
+
+	d := diagnoseError(signature)
+	if d == nil || !strings.Contains(d.Problem, "ahead of AWS") || d.ExitCode != exitInvalidCredentials {
+		t.Errorf("expected a clock diagnosis but got %v", d)
+	}
+
+	denied := awserr.New("AccessDenied", "explicit deny", nil)
+	if d := diagnoseError(denied); d == nil || strings.Contains(d.Problem, "clock") {
+		t.Errorf("expected an access denied diagnosis but got %v", d)
+	}
+}
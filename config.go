@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
 
 	"github.com/go-yaml/yaml"
 )
@@ -16,28 +20,133 @@ type aliasLocation struct {
 }
 
 type Alias struct {
-	AccountNumber int    `yaml:"account_number" required:"true"`
-	DefaultRegion string `yaml:"default_region"`
-	Name          string `yaml:"name" required:"true"`
-	Role          string `yaml:"role" required:"true"`
+	AccountNumber int               `yaml:"account_number" required:"true"`
+	DefaultRegion string            `yaml:"default_region"`
+	Duration      string            `yaml:"duration"`
+	Federation    bool              `yaml:"federation_token"`
+	MFADevice     string            `yaml:"mfa_device"`
+	Name          string            `yaml:"name" required:"true"`
+	Policy        string            `yaml:"policy"`
+	Role          string            `yaml:"role"`
+	RoleArn       string            `yaml:"role_arn"`
+	SessionName   string            `yaml:"session_name"`
+	SessionTags   map[string]string `yaml:"session_tags"`
+
+	SessionNameTemplate string `yaml:"session_name_template"`
+
+	WebIdentityTokenFile string `yaml:"web_identity_token_file"`
+	WebIdentityTokenEnv  string `yaml:"web_identity_token_env"`
+
+	// Local emulators such as LocalStack, used with dummy credentials
+	EndpointURL        string            `yaml:"endpoint_url"`
+	ServiceEndpoints   map[string]string `yaml:"service_endpoints"`
+	AWSAccessKeyId     string            `yaml:"aws_access_key_id"`
+	AWSSecretAccessKey string            `yaml:"aws_secret_access_key"`
 }
 
 type Account struct {
+	Name               string  `yaml:"name"`
 	Aliases            []Alias `yaml:"aliases"`
 	AWSAccessKeyId     string  `yaml:"aws_access_key_id" required:"true"`
 	AWSSecretAccessKey string  `yaml:"aws_secret_access_key" required:"true"`
+	AWSSessionToken    string  `yaml:"aws_session_token"`
+	Source             string  `yaml:"source"`
 	MFARole            string  `yaml:"mfa_role" required:"true"`
+	SessionDuration    int     `yaml:"session_duration"`
+
+	MFACommand string      `yaml:"mfa_command"`
+	MFADevices []MFADevice `yaml:"mfa_devices"`
+	MFATOTP    *TOTPConfig `yaml:"mfa_totp"`
+
+	WebIdentityTokenFile string `yaml:"web_identity_token_file"`
+	WebIdentityTokenEnv  string `yaml:"web_identity_token_env"`
+
+	SSO           *SSOConfig           `yaml:"sso"`
+	RolesAnywhere *RolesAnywhereConfig `yaml:"roles_anywhere"`
+	Endpoints     *EndpointConfig      `yaml:"endpoints"`
+}
+
+// MFA device registered to an account's user, selected by its name
+type MFADevice struct {
+	Name string `yaml:"name" required:"true"`
+	ARN  string `yaml:"arn" required:"true"`
+}
+
+type CacheConfig struct {
+	Disabled     bool `yaml:"disabled"`
+	MinRemaining int  `yaml:"min_remaining"`
+}
+
+type LockConfig struct {
+	Timeout    int `yaml:"timeout"`
+	StaleAfter int `yaml:"stale_after"`
+}
+
+type KeysConfig struct {
+	MaxAgeDays int `yaml:"max_age_days"`
 }
 
 type Config struct {
-	Accounts []Account `yaml:"accounts"`
+	Accounts  []Account      `yaml:"accounts"`
+	Cache     CacheConfig    `yaml:"cache"`
+	Endpoints EndpointConfig `yaml:"endpoints"`
+	Keys      KeysConfig     `yaml:"keys"`
+	Lock      LockConfig     `yaml:"lock"`
+
+	MFACommand          string `yaml:"mfa_command"`
+	SessionNameTemplate string `yaml:"session_name_template"`
+
 	aliasMap map[string]aliasLocation
+	path     string
 }
 
 type SecurityCredentials struct {
 	AWSAccessKeyId     string
 	AWSSecretAccessKey string
+	AWSSessionToken    string
+	Source             string
 	MFARole            string
+	SessionDuration    int
+	MFACommand         string
+	MFADevices         []MFADevice
+	MFATOTP            *TOTPConfig
+
+	WebIdentityTokenFile string
+	WebIdentityTokenEnv  string
+
+	SSO           *SSOConfig
+	RolesAnywhere *RolesAnywhereConfig
+	Endpoints     *EndpointConfig
+}
+
+// Return the ARN of the role assumed for the alias, empty for aliases
+// without a role
+func (a *Alias) RoleARN() string {
+	if a.RoleArn != "" {
+		return a.RoleArn
+	}
+
+	if a.Role == "" {
+		return ""
+	}
+
+	return roleARN(strconv.Itoa(a.AccountNumber), a.Role)
+}
+
+// Split a role ARN into its account number and role name
+func parseRoleARN(arn string) (int, string, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "iam" || !strings.HasPrefix(parts[5], "role/") {
+		return 0, "", fmt.Errorf("%s is not a role ARN", arn)
+	}
+
+	accountNumber, err := strconv.Atoi(parts[4])
+	if err != nil {
+		return 0, "", fmt.Errorf("%s has an invalid account number", arn)
+	}
+
+	path := strings.Split(parts[5], "/")
+	return accountNumber, path[len(path)-1], nil
 }
 
 // Return an Alias based on the name
@@ -48,7 +157,20 @@ func (c *Config) GetAlias(name string) (*Alias, *SecurityCredentials, error) {
 		credentials := &SecurityCredentials{
 			AWSAccessKeyId:     account.AWSAccessKeyId,
 			AWSSecretAccessKey: account.AWSSecretAccessKey,
+			AWSSessionToken:    account.AWSSessionToken,
+			Source:             account.Source,
 			MFARole:            account.MFARole,
+			SessionDuration:    account.SessionDuration,
+			MFACommand:         c.AccountMFACommand(&account),
+			MFADevices:         account.MFADevices,
+			MFATOTP:            account.MFATOTP,
+
+			WebIdentityTokenFile: account.WebIdentityTokenFile,
+			WebIdentityTokenEnv:  account.WebIdentityTokenEnv,
+
+			SSO:           account.SSO,
+			RolesAnywhere: account.RolesAnywhere,
+			Endpoints:     c.AccountEndpoints(&account),
 		}
 
 		alias := &account.Aliases[location.aliasIndex]
@@ -59,6 +181,91 @@ func (c *Config) GetAlias(name string) (*Alias, *SecurityCredentials, error) {
 	return nil, nil, fmt.Errorf("alias %s does not exist", name)
 }
 
+// Return an Account based on the name
+func (c *Config) GetAccount(name string) (*Account, error) {
+	for i := range c.Accounts {
+		if c.Accounts[i].Name == name {
+			return &c.Accounts[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("account %s does not exist", name)
+}
+
+// Return the name of the account, or its access key when it has none
+func (a *Account) DisplayName() string {
+	if a.Name != "" {
+		return a.Name
+	}
+
+	return a.AWSAccessKeyId
+}
+
+// Return the MFA device with the given name or ARN, or the default device
+// when the selector is empty: mfa_role, else the first of mfa_devices. Nil
+// is returned for accounts without MFA.
+func selectMFADevice(mfaRole string, devices []MFADevice, selector string) (*MFADevice, error) {
+	if selector == "" {
+		switch {
+		case mfaRole != "":
+			return &MFADevice{ARN: mfaRole}, nil
+		case len(devices) > 0:
+			return &devices[0], nil
+		}
+
+		return nil, nil
+	}
+
+	for i := range devices {
+		if devices[i].Name == selector || devices[i].ARN == selector {
+			return &devices[i], nil
+		}
+	}
+
+	if selector == mfaRole || strings.HasPrefix(selector, "arn:") {
+		return &MFADevice{ARN: selector}, nil
+	}
+
+	return nil, fmt.Errorf("mfa device %s is not in mfa_devices", selector)
+}
+
+// Return the MFA device for the selector, see selectMFADevice
+func (s *SecurityCredentials) MFADevice(selector string) (*MFADevice, error) {
+	return selectMFADevice(s.MFARole, s.MFADevices, selector)
+}
+
+// Return the ARN of the account's default MFA device, empty without one
+func (a *Account) DefaultMFADevice() string {
+	device, _ := selectMFADevice(a.MFARole, a.MFADevices, "")
+	if device == nil {
+		return ""
+	}
+
+	return device.ARN
+}
+
+// Return the network settings for an account, its own settings replacing
+// the global ones
+func (c *Config) AccountEndpoints(account *Account) *EndpointConfig {
+	endpoints := c.Endpoints.merge(account.Endpoints)
+	return &endpoints
+}
+
+// Return the command printing MFA token codes for an account, its own
+// replacing the global one
+func (c *Config) AccountMFACommand(account *Account) string {
+	if account.MFACommand != "" {
+		return account.MFACommand
+	}
+
+	return c.MFACommand
+}
+
+// Return the directory holding the configuration file, used for local state
+func (c *Config) StateDir() string {
+	return filepath.Dir(c.path)
+}
+
 // Return a slice of Alias names
 func (c *Config) AliasNames() []string {
 	aliases := make([]string, len(c.aliasMap))
@@ -96,10 +303,93 @@ func LoadConfig(filePath string) (*Config, error) {
 		return nil, err
 	}
 
+	for i, account := range config.Accounts {
+		// Accounts holding only local aliases need no credentials
+		if !account.localOnly() {
+			if err := validateSource(account); err != nil {
+				return nil, fmt.Errorf("account %d: %s", i+1, err)
+			}
+		}
+
+		if account.SessionDuration > maxSessionDuration {
+			return nil, fmt.Errorf(
+				"session_duration %d exceeds the maximum of %d seconds",
+				account.SessionDuration,
+				maxSessionDuration,
+			)
+		}
+
+		names := make(map[string]bool)
+		for _, device := range account.MFADevices {
+			if err := Validate(device); err != nil {
+				return nil, fmt.Errorf("account %d: mfa_devices: %s", i+1, err)
+			}
+
+			if names[device.Name] {
+				return nil, fmt.Errorf("account %d: mfa device %s is listed twice", i+1, device.Name)
+			}
+			names[device.Name] = true
+		}
+
+		if account.MFATOTP != nil {
+			if account.DefaultMFADevice() == "" {
+				return nil, fmt.Errorf("account %d: mfa_totp requires mfa_role or mfa_devices", i+1)
+			}
+
+			if err := account.MFATOTP.validate(); err != nil {
+				return nil, fmt.Errorf("account %d: %s", i+1, err)
+			}
+		}
+
+		endpoints := config.Endpoints.merge(account.Endpoints)
+		if err := endpoints.validate(); err != nil {
+			return nil, fmt.Errorf("account %d: %s", i+1, err)
+		}
+	}
+	config.path = filePath
+
+	if _, err := template.New("session_name").Parse(config.SessionNameTemplate); err != nil {
+		return nil, fmt.Errorf("invalid session_name_template: %s", err)
+	}
+
 	// Populate aliasMap
 	config.aliasMap = make(map[string]aliasLocation)
 	for accountIndex, account := range config.Accounts {
 		for aliasIndex, alias := range account.Aliases {
+			if alias.Federation && alias.RoleARN() != "" {
+				return nil, fmt.Errorf("alias %s can not set both federation_token and a role", alias.Name)
+			}
+
+			if alias.Federation && alias.Policy == "" {
+				return nil, fmt.Errorf("alias %s sets federation_token without a policy", alias.Name)
+			}
+
+			if err := alias.validateLocal(); err != nil {
+				return nil, fmt.Errorf("alias %s: %s", alias.Name, err)
+			}
+
+			if _, err := aliasDuration(alias.Duration, &alias); err != nil {
+				return nil, fmt.Errorf("alias %s: %s", alias.Name, err)
+			}
+
+			if _, err := selectMFADevice(account.MFARole, account.MFADevices, alias.MFADevice); err != nil {
+				return nil, fmt.Errorf("alias %s: %s", alias.Name, err)
+			}
+
+			if _, err := template.New("session_name").Parse(alias.SessionNameTemplate); err != nil {
+				return nil, fmt.Errorf("alias %s: invalid session_name_template: %s", alias.Name, err)
+			}
+
+			if alias.RoleArn != "" {
+				accountNumber, role, err := parseRoleARN(alias.RoleArn)
+				if err != nil {
+					return nil, fmt.Errorf("alias %s: %s", alias.Name, err)
+				}
+
+				account.Aliases[aliasIndex].AccountNumber = accountNumber
+				account.Aliases[aliasIndex].Role = role
+			}
+
 			config.aliasMap[alias.Name] = aliasLocation{
 				accountIndex: accountIndex,
 				aliasIndex:   aliasIndex,
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseRoleARN(t *testing.T) {
+	accountNumber, role, err := parseRoleARN("arn:aws:iam::123456789012:role/ci/deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if accountNumber != 123456789012 || role != "deploy" {
+		t.Errorf("expected 123456789012 and deploy but got %d and %s", accountNumber, role)
+	}
+
+	if _, _, err := parseRoleARN("arn:aws:iam::123456789012:user/jim"); err == nil {
+		t.Error("expected error but got nil")
+	}
+}
+
+func TestSelectMFADevice(t *testing.T) {
+	devices := []MFADevice{
+		{Name: "phone", ARN: "arn:aws:iam::123456789012:mfa/jim"},
+		{Name: "yubikey", ARN: "arn:aws:iam::123456789012:mfa/jim-yubikey"},
+	}
+
+	tests := map[string]string{
+		"":        "arn:aws:iam::123456789012:mfa/jim",
+		"yubikey": "arn:aws:iam::123456789012:mfa/jim-yubikey",
+		"arn:aws:iam::123456789012:mfa/jim-yubikey": "arn:aws:iam::123456789012:mfa/jim-yubikey",
+	}
+
+	for selector, expected := range tests {
+		device, err := selectMFADevice("", devices, selector)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", selector, err)
+		} else if device.ARN != expected {
+			t.Errorf("expected %s for %q but got %s", expected, selector, device.ARN)
+		}
+	}
+
+	if _, err := selectMFADevice("", devices, "tablet"); err == nil {
+		t.Error("expected error for an unknown device")
+	}
+
+	if device, _ := selectMFADevice("arn:aws:iam::123456789012:mfa/role", devices, ""); device.ARN != "arn:aws:iam::123456789012:mfa/role" {
+		t.Errorf("expected mfa_role to be the default but got %s", device.ARN)
+	}
+
+	if device, _ := selectMFADevice("", nil, ""); device != nil {
+		t.Errorf("expected no device but got %s", device.ARN)
+	}
+}
@@ -10,13 +10,12 @@ import (
 	"runtime"
 	"sort"
 	"strconv"
-	"strings"
 	"text/template"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/sts"
 )
 
@@ -36,16 +35,24 @@ type EnvVariables struct {
 	AccessKeyID     string
 	AccountName     string
 	Delimiter       string
+	Namespace       string
 	TokenExpiration string
 	Prefix          string
 	Region          string
 	SecretAccessKey string
 	SessionToken    string
 	Suffix          string
+
+	// Endpoints without a URL are unset with these, or left out when the
+	// format has no way to unset a variable
+	UnsetPrefix string
+	UnsetSuffix string
+
+	Endpoints []serviceEndpoint
 }
 
 func envTemplate() string {
-	var templ string = "{{ if .Region }}{{ .Prefix }}AWS_REGION{{ .Delimiter }}{{ .Region }}{{ .Suffix }}{{ .Prefix }}AWS_DEFAULT_REGION{{ .Delimiter }}{{ .Region }}{{ .Suffix }}{{ end }}"
+	var templ string = "{{ if .Region }}{{ .Prefix }}{{ .Namespace }}AWS_REGION{{ .Delimiter }}{{ .Region }}{{ .Suffix }}{{ .Prefix }}{{ .Namespace }}AWS_DEFAULT_REGION{{ .Delimiter }}{{ .Region }}{{ .Suffix }}{{ end }}"
 
 	keys := []string{}
 	for env, _ := range envVariables {
@@ -55,11 +62,16 @@ func envTemplate() string {
 
 	for _, key := range keys {
 		templ += fmt.Sprintf(
-			"{{ .Prefix }}%s{{ .Delimiter }}{{ %s }}{{ .Suffix }}",
+			"{{ .Prefix }}{{ .Namespace }}%s{{ .Delimiter }}{{ %s }}{{ .Suffix }}",
 			key,
 			envVariables[key],
 		)
 	}
+	templ += "{{ range .Endpoints }}{{ if .URL }}" +
+		"{{ $.Prefix }}{{ $.Namespace }}{{ .Variable }}{{ $.Delimiter }}{{ .URL }}{{ $.Suffix }}" +
+		"{{ else if $.UnsetPrefix }}" +
+		"{{ $.UnsetPrefix }}{{ $.Namespace }}{{ .Variable }}{{ $.UnsetSuffix }}" +
+		"{{ end }}{{ end }}"
 
 	return templ
 }
@@ -79,118 +91,430 @@ func detectShell() string {
 	return userShell
 }
 
-// Generate Session Name
-func generateSessionName(roleName, mfaDeviceID string) string {
-	userName := ""
-	if mfaDeviceID != "" {
-		userName = strings.Split(mfaDeviceID, "mfa/")[1]
-	}
-
-	timestamp := time.Now().Unix()
-
-	return fmt.Sprintf("%s@%s_%d", userName, roleName, timestamp)
-}
-
-type AWSCredentials struct {
-	AccessKeyID     string
-	SecretAccessKey string
-}
-
-func (a AWSCredentials) Retrieve() (credentials.Value, error) {
-	return credentials.Value{
-		AccessKeyID:     a.AccessKeyID,
-		SecretAccessKey: a.SecretAccessKey,
-		ProviderName:    "tok",
-	}, nil
+type assumeRoleInput struct {
+	Credentials *credentials.Credentials `required:"true"`
+	RoleArn     string                   `required:"true"`
+	RoleName    string
+	MFADeviceID string
+	TokenCode   string
+	SessionName string
+	Duration    int
+	Policy      string
+	SessionTags map[string]string
+	Endpoints   *EndpointConfig
 }
 
-func (a AWSCredentials) IsExpired() bool {
-	return false
+// Return the ARN of a role in an account
+func roleARN(accountNumber, roleName string) string {
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", accountNumber, roleName)
 }
 
-type assumeRoleInput struct {
-	AWSAccessKeyID     string `required:"true"`
-	AWSSecretAccessKey string `required:"true"`
-	AWSAccountNumber   string `required:"true"`
-	RoleName           string `required:"true"`
-	MFADeviceID        string `required:"true"`
-	TokenCode          string `required:"true"`
-	SessionName        string
-	Duration           int
+// Return a handler adding session tags to an AssumeRole request. The
+// vendored SDK predates the Tags parameter so it is appended to the query
+// after the request body has been built.
+func sessionTagsHandler(tags map[string]string) func(*request.Request) {
+	return func(r *request.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			r.Error = err
+			return
+		}
+
+		params, err := url.ParseQuery(string(body))
+		if err != nil {
+			r.Error = err
+			return
+		}
+
+		keys := []string{}
+		for key := range tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for i, key := range keys {
+			params.Set(fmt.Sprintf("Tags.member.%d.Key", i+1), key)
+			params.Set(fmt.Sprintf("Tags.member.%d.Value", i+1), tags[key])
+		}
+
+		r.SetBufferBody([]byte(params.Encode()))
+	}
 }
 
 func assumeRole(input assumeRoleInput) (*sts.AssumeRoleOutput, error) {
-	creds := AWSCredentials{
-		AccessKeyID:     input.AWSAccessKeyID,
-		SecretAccessKey: input.AWSSecretAccessKey,
-	}
-
-	svc := sts.New(session.New(
-		&aws.Config{
-			Credentials: credentials.NewCredentials(&creds),
-		},
-	))
-	roleArn := fmt.Sprintf(
-		"arn:aws:iam::%s:role/%s",
-		input.AWSAccountNumber,
-		input.RoleName,
-	)
+	svc, err := newSTSClient(input.Credentials, input.Endpoints)
+	if err != nil {
+		return nil, err
+	}
 
 	sessionName := input.SessionName
 	if len(sessionName) == 0 {
-		sessionName = generateSessionName(input.RoleName, input.MFADeviceID)
+		sessionName, err = generateSessionName(sessionNameInput{
+			Role:        input.RoleName,
+			MFADeviceID: input.MFADeviceID,
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	stsInput := &sts.AssumeRoleInput{
 		DurationSeconds: aws.Int64(int64(input.Duration)),
-		RoleArn:         aws.String(roleArn),
+		RoleArn:         aws.String(input.RoleArn),
 		RoleSessionName: aws.String(sessionName),
 	}
 
-	if input.MFADeviceID != "" {
+	if input.TokenCode != "" {
 		stsInput.SerialNumber = aws.String(input.MFADeviceID)
 		stsInput.TokenCode = aws.String(input.TokenCode)
 	}
 
-	return svc.AssumeRole(stsInput)
+	if input.Policy != "" {
+		stsInput.Policy = aws.String(input.Policy)
+	}
+
+	ctx, cancel := newRequestContext()
+	defer cancel()
+
+	req, output := svc.AssumeRoleRequest(stsInput)
+	req.SetContext(ctx)
+	if input.TokenCode != "" {
+		req.ApplyOptions(withoutRetries)
+	}
+	if len(input.SessionTags) > 0 {
+		req.Handlers.Build.PushBack(sessionTagsHandler(input.SessionTags))
+	}
+
+	return output, requestError(ctx, req.Send())
+}
+
+// Options shared by every command that resolves an alias to credentials
+type roleCredentialsInput struct {
+	Credentials       *credentials.Credentials `required:"true"`
+	AccountName       string                   `required:"true"`
+	AWSAccountNumber  string
+	RoleArn           string
+	RoleName          string
+	Federation        bool
+	SAML              bool
+	WebIdentityToken  *webIdentityToken
+	SSO               *SSOConfig
+	RolesAnywhere     *RolesAnywhereConfig
+	MFADeviceID       string
+	MFAToken          mfaToken
+	StateDir          string `required:"true"`
+	SessionDuration   int
+	SessionName       string
+	SessionTemplate   string
+	Reason            string
+	Duration          int
+	Policy            string
+	SessionTags       map[string]string
+	Cache             cacheMode
+	CacheMinRemaining time.Duration
+	Lock              lockOptions
+	Endpoints         *EndpointConfig
+}
+
+// Return the session name set for the alias, otherwise one rendered from
+// its template. Identity credentials are used to look up the user name.
+func (input *roleCredentialsInput) sessionName(identity *credentials.Credentials) (string, error) {
+	if input.SessionName != "" {
+		return sanitizeSessionName(input.SessionName), nil
+	}
+
+	return generateSessionName(sessionNameInput{
+		Template:    input.SessionTemplate,
+		Alias:       input.AccountName,
+		Role:        input.RoleName,
+		MFADeviceID: input.MFADeviceID,
+		Reason:      input.Reason,
+		Credentials: identity,
+		Endpoints:   input.Endpoints,
+	})
+}
+
+// Return the key of the alias's cached credentials. SAML credentials are
+// issued by the saml command, which sets their session name and duration.
+func (input *roleCredentialsInput) cacheKey() string {
+	key := cacheKeyInput{
+		Alias:       input.AccountName,
+		RoleArn:     input.RoleArn,
+		MFADeviceID: input.MFADeviceID,
+		Policy:      input.Policy,
+		Tags:        input.SessionTags,
+	}
+
+	if !input.SAML {
+		key.SessionName = input.SessionName
+		key.SessionTemplate = input.SessionTemplate
+		key.Reason = input.Reason
+		key.Duration = input.Duration
+	}
+
+	return credentialCacheKey(key)
+}
+
+// Return credentials for the alias from the local cache when allowed,
+// otherwise resolve them with roleCredentials and cache the result
+func cachedRoleCredentials(input roleCredentialsInput) (*sessionCredentials, error) {
+	// Role-less aliases already reuse the stored MFA session
+	if input.Cache == cacheDisabled || (input.RoleArn == "" && !input.Federation) {
+		return roleCredentials(input)
+	}
+
+	cache, err := openCredentialCache(input.StateDir, input.CacheMinRemaining)
+	if err != nil {
+		return nil, err
+	}
+
+	key := input.cacheKey()
+
+	if input.Cache == cacheEnabled {
+		creds, err := cache.Get(key)
+		if err != nil || creds != nil {
+			return creds, err
+		}
+	}
+
+	// Concurrent processes for the same alias wait for the first one to
+	// refresh the credentials and then read them from the cache
+	lock, err := acquireLock(lockPath(input.StateDir, key), input.Lock)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	if input.Cache == cacheEnabled {
+		creds, err := cache.Get(key)
+		if err != nil || creds != nil {
+			return creds, err
+		}
+	}
+
+	creds, err := roleCredentials(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cache.Put(key, creds); err != nil {
+		return nil, err
+	}
+
+	return creds, nil
+}
+
+// Resolve an alias to temporary credentials. Accounts with long-term keys
+// and an MFA device assume roles using a stored MFA session so the token is
+// only requested when that session expires. Aliases without a role receive
+// the session credentials themselves.
+func roleCredentials(input roleCredentialsInput) (*sessionCredentials, error) {
+	if input.SSO != nil {
+		if input.RoleName == "" {
+			return nil, fmt.Errorf("alias %s needs a role naming its sso permission set", input.AccountName)
+		}
+
+		return ssoRoleCredentials(ssoRoleCredentialsInput{
+			Config:        input.SSO,
+			AccountNumber: input.AWSAccountNumber,
+			RoleName:      input.RoleName,
+			StateDir:      input.StateDir,
+			Lock:          input.Lock,
+			Endpoints:     input.Endpoints,
+		})
+	}
+
+	if input.Federation {
+		if input.Credentials == nil {
+			return nil, fmt.Errorf("alias %s needs an account with access keys to use a federation token", input.AccountName)
+		}
+
+		name := input.SessionName
+		if name == "" {
+			name = input.AccountName
+		}
+
+		return getFederationToken(federationTokenInput{
+			Credentials: input.Credentials,
+			Name:        name,
+			Duration:    input.Duration,
+			Policy:      input.Policy,
+			Endpoints:   input.Endpoints,
+		})
+	}
+
+	if input.RolesAnywhere != nil {
+		if input.RoleArn == "" {
+			return nil, fmt.Errorf("alias %s needs a role to use roles anywhere", input.AccountName)
+		}
+
+		return rolesAnywhereCredentials(rolesAnywhereInput{
+			Config:    input.RolesAnywhere,
+			RoleArn:   input.RoleArn,
+			Duration:  input.Duration,
+			Endpoints: input.Endpoints,
+		})
+	}
+
+	if input.WebIdentityToken != nil {
+		if input.RoleArn == "" {
+			return nil, fmt.Errorf("alias %s needs a role to use a web identity token", input.AccountName)
+		}
+
+		sessionName, err := input.sessionName(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result *sts.AssumeRoleWithWebIdentityOutput
+		err = withDurationFallback(input.Duration, func(duration int) error {
+			var err error
+			result, err = assumeRoleWithWebIdentity(assumeRoleWithWebIdentityInput{
+				Token:       input.WebIdentityToken,
+				RoleArn:     input.RoleArn,
+				RoleName:    input.RoleName,
+				SessionName: sessionName,
+				Duration:    duration,
+				Policy:      input.Policy,
+				Endpoints:   input.Endpoints,
+			})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return newSessionCredentials(result.Credentials), nil
+	}
+
+	base, err := input.Credentials.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	sessionName := ""
+	if input.RoleArn != "" {
+		if sessionName, err = input.sessionName(input.Credentials); err != nil {
+			return nil, err
+		}
+	}
+
+	assumeInput := assumeRoleInput{
+		Credentials: input.Credentials,
+		RoleArn:     input.RoleArn,
+		RoleName:    input.RoleName,
+		MFADeviceID: input.MFADeviceID,
+		SessionName: sessionName,
+		Duration:    input.Duration,
+		Policy:      input.Policy,
+		SessionTags: input.SessionTags,
+		Endpoints:   input.Endpoints,
+	}
+
+	// Temporary base credentials can not request an MFA session, so the
+	// token is sent with AssumeRole instead
+	sendToken := false
+	if base.SessionToken != "" {
+		if input.RoleArn == "" {
+			return &sessionCredentials{
+				AccessKeyID:     base.AccessKeyID,
+				SecretAccessKey: base.SecretAccessKey,
+				SessionToken:    base.SessionToken,
+			}, nil
+		}
+
+		sendToken = input.MFADeviceID != ""
+	} else if input.MFADeviceID != "" || input.RoleArn == "" {
+		mfaCreds, err := mfaSession(sessionTokenInput{
+			Credentials:    input.Credentials,
+			AWSAccessKeyID: base.AccessKeyID,
+			MFADeviceID:    input.MFADeviceID,
+			MFAToken:       input.MFAToken,
+			StateDir:       input.StateDir,
+			Duration:       input.SessionDuration,
+			Lock:           input.Lock,
+			Endpoints:      input.Endpoints,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if input.RoleArn == "" {
+			return mfaCreds, nil
+		}
+
+		assumeInput.Credentials = mfaCreds.provider()
+	}
+
+	var result *sts.AssumeRoleOutput
+	err = withDurationFallback(input.Duration, func(duration int) error {
+		assumeInput.Duration = duration
+		if !sendToken {
+			result, err = assumeRole(assumeInput)
+			return err
+		}
+
+		// Each attempt asks for a code since codes can not be reused
+		return withMFAToken(input.StateDir, input.MFADeviceID, input.MFAToken, func(code string) error {
+			assumeInput.TokenCode = code
+			result, err = assumeRole(assumeInput)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, &assumeRoleError{err: err, mfa: input.MFADeviceID != ""}
+	}
+
+	return newSessionCredentials(result.Credentials), nil
 }
 
 type webOutInput struct {
-	AWSAccessKeyID     string `required:"true"`
-	AWSSecretAccessKey string `required:"true"`
-	AccountName        string `required:"true"`
-	AWSAccountNumber   string `required:"true"`
-	RoleName           string `required:"true"`
-	MFADeviceID        string `required:"true"`
-	TokenCode          string `required:"true"`
-	SessionName        string
-	Duration           int
+	roleCredentialsInput
 }
 
 func webOut(input webOutInput) (string, error) {
-	assumeInput := assumeRoleInput{
-		AWSAccessKeyID:     input.AWSAccessKeyID,
-		AWSSecretAccessKey: input.AWSSecretAccessKey,
-		AWSAccountNumber:   input.AWSAccountNumber,
-		RoleName:           input.RoleName,
-		MFADeviceID:        input.MFADeviceID,
-		TokenCode:          input.TokenCode,
-		SessionName:        input.SessionName,
-		Duration:           input.Duration,
+	if input.RoleArn == "" && !input.Federation {
+		return "", fmt.Errorf(
+			"alias %s has no role, console sign-in requires a role or federation token",
+			input.AccountName,
+		)
 	}
 
-	result, err := assumeRole(assumeInput)
+	if !input.Federation {
+		if err := checkConsoleDuration(input.Duration); err != nil {
+			return "", err
+		}
+	}
+
+	result, err := cachedRoleCredentials(input.roleCredentialsInput)
 	if err != nil {
 		return "", err
 	}
+
+	// Console sessions of federated users last as long as their credentials
+	if input.Federation {
+		return signinURL(result, 0, input.Endpoints)
+	}
+
+	duration, err := consoleDuration(input.Duration, result.Expiration)
+	if err != nil {
+		return "", err
+	}
+
+	return signinURL(result, duration, input.Endpoints)
+}
+
+// Exchange credentials for a console sign-in URL. A zero duration omits
+// SessionDuration, which federation token credentials do not accept.
+func signinURL(result *sessionCredentials, duration int, endpoints *EndpointConfig) (string, error) {
 	tmpCredentials := struct {
 		SessionID    string `json:"sessionId"`
 		SessionKey   string `json:"sessionKey"`
 		SessionToken string `json:"sessionToken"`
 	}{
-		SessionID:    aws.StringValue(result.Credentials.AccessKeyId),
-		SessionKey:   aws.StringValue(result.Credentials.SecretAccessKey),
-		SessionToken: aws.StringValue(result.Credentials.SessionToken),
+		SessionID:    result.AccessKeyID,
+		SessionKey:   result.SecretAccessKey,
+		SessionToken: result.SessionToken,
 	}
 
 	credentialsJson, err := json.Marshal(&tmpCredentials)
@@ -199,23 +523,44 @@ func webOut(input webOutInput) (string, error) {
 	}
 
 	federationRequestParams := fmt.Sprintf(
-		"?Action=getSigninToken&SessionDuration=%d&Session=%s",
-		input.Duration,
+		"?Action=getSigninToken&Session=%s",
 		url.QueryEscape(string(credentialsJson)),
 	)
+	if duration > 0 {
+		federationRequestParams += fmt.Sprintf("&SessionDuration=%d", duration)
+	}
 
-	tokenResp, err := http.Get("https://signin.aws.amazon.com/federation" + federationRequestParams)
+	client, err := endpoints.httpClient()
 	if err != nil {
 		return "", err
 	}
 
+	tokenResp, err := sendHTTPRequest(client, true, func() (*http.Request, error) {
+		return http.NewRequest("GET", endpoints.federationEndpoint()+federationRequestParams, nil)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if tokenResp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf(
+			"federation endpoint returned %d %s: %s",
+			tokenResp.StatusCode,
+			http.StatusText(tokenResp.StatusCode),
+			tokenResp.bodySnippet(),
+		)
+	}
+
 	tokenRespObj := struct {
 		SigninToken string `json:"SigninToken"`
 	}{}
 
-	responseBody, _ := ioutil.ReadAll(tokenResp.Body)
-	if err := json.Unmarshal(responseBody, &tokenRespObj); err != nil {
-		return "", err
+	if err := json.Unmarshal(tokenResp.Body, &tokenRespObj); err != nil || tokenRespObj.SigninToken == "" {
+		return "", fmt.Errorf(
+			"federation endpoint returned an unexpected %s response: %s",
+			tokenResp.Header.Get("Content-Type"),
+			tokenResp.bodySnippet(),
+		)
 	}
 
 	signinRequestParams := fmt.Sprintf(
@@ -224,49 +569,47 @@ func webOut(input webOutInput) (string, error) {
 		tokenRespObj.SigninToken,
 	)
 
-	return "https://signin.aws.amazon.com/federation" + signinRequestParams, nil
+	return endpoints.federationEndpoint() + signinRequestParams, nil
 }
 
-type credentialsOutInput struct {
-	AWSAccessKeyID     string `required:"true"`
-	AWSSecretAccessKey string `required:"true"`
-	AccountName        string `required:"true"`
-	AWSAccountNumber   string `required:"true"`
-	RoleName           string `required:"true"`
-	MFADeviceID        string `required:"true"`
-	TokenCode          string `required:"true"`
-	SessionName        string
-	Duration           int
-	Region             string `required:"true"`
-	UserShell          string
+type envOutInput struct {
+	AccountName      string
+	AccountID        string
+	Region           string
+	UserShell        string
+	EndpointURL      string
+	ServiceEndpoints []serviceEndpoint
+
+	// Prepended to variable names when several aliases are exported
+	Namespace string
 }
 
-func credentialOut(input credentialsOutInput) (string, error) {
-	assumeInput := assumeRoleInput{
-		AWSAccessKeyID:     input.AWSAccessKeyID,
-		AWSSecretAccessKey: input.AWSSecretAccessKey,
-		AWSAccountNumber:   input.AWSAccountNumber,
-		RoleName:           input.RoleName,
-		MFADeviceID:        input.MFADeviceID,
-		TokenCode:          input.TokenCode,
-		SessionName:        input.SessionName,
-		Duration:           input.Duration,
-	}
+// Return the endpoint variables, AWS_ENDPOINT_URL followed by those of
+// each service
+func (input *envOutInput) endpoints() []serviceEndpoint {
+	return append(
+		[]serviceEndpoint{{Variable: "AWS_ENDPOINT_URL", URL: input.EndpointURL}},
+		input.ServiceEndpoints...,
+	)
+}
 
-	result, err := assumeRole(assumeInput)
-	if err != nil {
-		return "", err
+// Render credentials as environment variables in the user's shell format
+func envOut(result *sessionCredentials, input envOutInput) (string, error) {
+	// Expiration is unknown for temporary base credentials exported as is
+	expiration := ""
+	if !result.Expiration.IsZero() {
+		expiration = strconv.FormatInt(result.Expiration.Unix(), 10)
 	}
-
-	expiration := strconv.FormatInt(result.Credentials.Expiration.Unix(), 10)
 	tmplVariables := EnvVariables{
 		AccountName:     input.AccountName,
-		AccountID:       input.AWSAccountNumber,
+		AccountID:       input.AccountID,
 		Region:          input.Region,
-		AccessKeyID:     aws.StringValue(result.Credentials.AccessKeyId),
+		AccessKeyID:     result.AccessKeyID,
 		TokenExpiration: expiration,
-		SecretAccessKey: aws.StringValue(result.Credentials.SecretAccessKey),
-		SessionToken:    aws.StringValue(result.Credentials.SessionToken),
+		SecretAccessKey: result.SecretAccessKey,
+		SessionToken:    result.SessionToken,
+		Namespace:       input.Namespace,
+		Endpoints:       input.endpoints(),
 	}
 
 	// Set UserShell
@@ -279,6 +622,8 @@ func credentialOut(input credentialsOutInput) (string, error) {
 		tmplVariables.Delimiter = " = '"
 		tmplVariables.Prefix = "$env:"
 		tmplVariables.Suffix = "'\n"
+		tmplVariables.UnsetPrefix = "Remove-Item Env:"
+		tmplVariables.UnsetSuffix = " -ErrorAction SilentlyContinue\n"
 	case "docker":
 		tmplVariables.Delimiter = "="
 		tmplVariables.Prefix = " -e "
@@ -287,10 +632,18 @@ func credentialOut(input credentialsOutInput) (string, error) {
 		tmplVariables.Delimiter = "="
 		tmplVariables.Prefix = "set "
 		tmplVariables.Suffix = "\n"
+		tmplVariables.UnsetPrefix = "set "
+		tmplVariables.UnsetSuffix = "=\n"
+	case "env":
+		tmplVariables.Delimiter = "="
+		tmplVariables.Prefix = ""
+		tmplVariables.Suffix = "\n"
 	default:
 		tmplVariables.Delimiter = "="
 		tmplVariables.Prefix = "export "
 		tmplVariables.Suffix = "\n"
+		tmplVariables.UnsetPrefix = "unset "
+		tmplVariables.UnsetSuffix = "\n"
 	}
 
 	var tmpl *template.Template
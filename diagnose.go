@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// Process exit codes for failures scripts may want to handle
+const (
+	exitMFAInvalid         = 10
+	exitMFARequired        = 11
+	exitAccessDenied       = 12
+	exitDurationTooLong    = 13
+	exitInvalidCredentials = 14
+	exitRegionDisabled     = 15
+	exitPromptDisabled     = 16
+)
+
+// Explanation of a known failure with a suggested fix
+type diagnosis struct {
+	Problem  string
+	Fix      string
+	ExitCode int
+}
+
+func (d *diagnosis) String() string {
+	return fmt.Sprintf("%s\n%s", d.Problem, d.Fix)
+}
+
+// Error from assuming a role along with whether the caller authenticated
+// with MFA, which tells a trust policy requiring MFA apart from other denials
+type assumeRoleError struct {
+	err error
+	mfa bool
+}
+
+func (e *assumeRoleError) Error() string {
+	return e.err.Error()
+}
+
+// Classify an error from getting credentials, nil for errors without a
+// diagnosis. Signing and MFA failures are blamed on the local clock when
+// responses showed it is off.
+func diagnoseError(err error) *diagnosis {
+	d := diagnoseAWSError(err)
+	if d == nil || (d.ExitCode != exitMFAInvalid && d.ExitCode != exitInvalidCredentials) {
+		return d
+	}
+
+	if offset, ok := observedClockSkew(); ok && clockSkewed(offset) {
+		d.Problem = fmt.Sprintf("The local clock is %s, which makes signatures and MFA token codes fail.", formatClockSkew(offset))
+		d.Fix = "Synchronize the system clock with network time and try again, aws-session doctor checks it."
+	}
+
+	return d
+}
+
+func diagnoseAWSError(err error) *diagnosis {
+	mfa, knownMFA := false, false
+	if roleErr, ok := err.(*assumeRoleError); ok {
+		err = roleErr.err
+		mfa, knownMFA = roleErr.mfa, true
+	}
+
+	if err == errPromptDisabled {
+		return &diagnosis{
+			Problem:  "No MFA token code was available without prompting.",
+			Fix:      "Pass --token-code, set mfa_command, mfa_totp or AWS_SESSION_ASKPASS, or run without --no-prompt.",
+			ExitCode: exitPromptDisabled,
+		}
+	}
+
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return nil
+	}
+	message := aerr.Message()
+
+	switch aerr.Code() {
+	case "AccessDenied":
+		switch {
+		case strings.Contains(message, "MultiFactorAuthentication failed"):
+			return &diagnosis{
+				Problem:  "The MFA token code was rejected because it expired or was already used.",
+				Fix:      "Wait for the next code from the device and try again, and check that the device clock is correct.",
+				ExitCode: exitMFAInvalid,
+			}
+		case knownMFA && !mfa && strings.Contains(message, "sts:AssumeRole"):
+			return &diagnosis{
+				Problem:  "The role could not be assumed without MFA, its trust policy most likely requires it.",
+				Fix:      "Set mfa_role on the account to the ARN of the MFA device so a token code is sent.",
+				ExitCode: exitMFARequired,
+			}
+		case strings.Contains(message, "explicit deny"):
+			return &diagnosis{
+				Problem:  "A policy of the caller explicitly denies the request.",
+				Fix:      "Remove the deny from the caller's identity policies, permission boundary or the organization's SCPs.",
+				ExitCode: exitAccessDenied,
+			}
+		case strings.Contains(message, "sts:AssumeRole"):
+			return &diagnosis{
+				Problem:  "The caller is not allowed to assume the role.",
+				Fix:      "Check that the role's trust policy names the caller as a principal and its conditions are met, and that the caller's identity policy allows sts:AssumeRole on the role.",
+				ExitCode: exitAccessDenied,
+			}
+		}
+	case "ValidationError":
+		if _, ok := durationRejected(aerr); ok {
+			fix := "Request a shorter --duration or raise the maximum session duration of the role."
+			if strings.Contains(message, "role chaining") {
+				fix = "Roles assumed with credentials of another role are limited to one hour, request a --duration of 3600 or less."
+			}
+
+			return &diagnosis{
+				Problem:  "The requested duration is longer than the role allows.",
+				Fix:      fix,
+				ExitCode: exitDurationTooLong,
+			}
+		}
+	case "InvalidClientTokenId", "SignatureDoesNotMatch", "RequestExpired":
+		return &diagnosis{
+			Problem:  "The access key was not accepted, it may have been deleted or deactivated, or the secret key is wrong.",
+			Fix:      "Check the key with aws-session keys status or replace it in the configuration file.",
+			ExitCode: exitInvalidCredentials,
+		}
+	case "ExpiredToken", "ExpiredTokenException":
+		return &diagnosis{
+			Problem:  "The session token of the base credentials has expired.",
+			Fix:      "Refresh the account's credentials, or run again with --refresh to replace cached credentials.",
+			ExitCode: exitInvalidCredentials,
+		}
+	case "RegionDisabledException":
+		return &diagnosis{
+			Problem:  "STS is not activated in the region of the endpoint for this account.",
+			Fix:      "Activate the region in the IAM account settings or set sts_region to an enabled region.",
+			ExitCode: exitRegionDisabled,
+		}
+	}
+
+	return nil
+}
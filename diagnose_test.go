@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestDiagnoseError(t *testing.T) {
+	notAuthorized := awserr.New(
+		"AccessDenied",
+		"User: arn:aws:iam::123456789012:user/jim is not authorized to perform: sts:AssumeRole on resource: arn:aws:iam::210987654321:role/Admin",
+		nil,
+	)
+
+	tests := []struct {
+		err      error
+		exitCode int
+	}{
+		{awserr.New("AccessDenied", "MultiFactorAuthentication failed with invalid MFA one time pass code. ", nil), exitMFAInvalid},
+		{&assumeRoleError{err: notAuthorized, mfa: false}, exitMFARequired},
+		{&assumeRoleError{err: notAuthorized, mfa: true}, exitAccessDenied},
+		{notAuthorized, exitAccessDenied},
+		{awserr.New("ValidationError", "The requested DurationSeconds exceeds the MaxSessionDuration set for this role.", nil), exitDurationTooLong},
+		{awserr.New("InvalidClientTokenId", "The security token included in the request is invalid.", nil), exitInvalidCredentials},
+		{awserr.New("RegionDisabledException", "STS is not activated in this region for account:123456789012.", nil), exitRegionDisabled},
+	}
+
+	for _, test := range tests {
+		d := diagnoseError(test.err)
+		if d == nil {
+			t.Errorf("expected a diagnosis for %s", test.err)
+			continue
+		}
+
+		if d.ExitCode != test.exitCode {
+			t.Errorf("expected exit code %d for %s but got %d", test.exitCode, test.err, d.ExitCode)
+		}
+	}
+
+	if d := diagnoseError(fmt.Errorf("alias flag can not be empty")); d != nil {
+		t.Errorf("expected no diagnosis but got %s", d)
+	}
+}
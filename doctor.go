@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+const defaultSTSEndpoint = "https://sts.amazonaws.com"
+
+type doctorInput struct {
+	ConfigPath string `required:"true"`
+	Out        io.Writer
+}
+
+// Result of a single doctor check
+type doctorCheck struct {
+	Name   string
+	Failed bool
+	Detail string
+}
+
+// Run checks for common setup problems and print their results, failing
+// when any check fails
+func runDoctor(input doctorInput) error {
+	if err := Validate(input); err != nil {
+		return err
+	}
+
+	var checks []doctorCheck
+
+	config, err := LoadConfig(input.ConfigPath)
+	if err != nil {
+		checks = append(checks, doctorCheck{Name: "config", Failed: true, Detail: err.Error()})
+		config = &Config{}
+	} else {
+		checks = append(checks, doctorCheck{Name: "config", Detail: input.ConfigPath})
+
+		checks = append(checks, checkStateKey(config.StateDir()))
+	}
+
+	checks = append(checks, checkClock(&config.Endpoints))
+
+	w := tabwriter.NewWriter(input.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+
+	failed := 0
+	for _, check := range checks {
+		status := "ok"
+		if check.Failed {
+			status = "FAIL"
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", check.Name, status, check.Detail)
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+
+	return nil
+}
+
+// Check that the state key can be read, without creating it as commands do
+// on first use
+func checkStateKey(dir string) doctorCheck {
+	check := doctorCheck{Name: "state", Detail: dir}
+
+	path := filepath.Join(dir, stateKeyFilename)
+	key, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		check.Detail = "missing (created on first use)"
+	case err != nil:
+		check.Failed, check.Detail = true, err.Error()
+	case len(key) != stateKeySize:
+		check.Failed, check.Detail = true, fmt.Sprintf("%s is not a valid state key", path)
+	}
+
+	return check
+}
+
+// Compare the local clock with the Date header of the STS endpoint
+func checkClock(endpoints *EndpointConfig) doctorCheck {
+	check := doctorCheck{Name: "clock"}
+
+	offset, err := stsClockOffset(endpoints)
+	switch {
+	case err != nil:
+		check.Failed, check.Detail = true, err.Error()
+	case clockSkewed(offset):
+		check.Failed = true
+		check.Detail = fmt.Sprintf("%s, more than %s breaks MFA and signing", formatClockSkew(offset), maxClockSkew)
+	default:
+		check.Detail = formatClockSkew(offset)
+	}
+
+	return check
+}
+
+// Return the offset of the local clock from the STS endpoint's clock. Any
+// response carries a Date header so the request is not signed.
+func stsClockOffset(endpoints *EndpointConfig) (time.Duration, error) {
+	httpClient, err := endpoints.httpClient()
+	if err != nil {
+		return 0, err
+	}
+
+	endpoint := endpoints.stsEndpoint()
+	if endpoint == "" {
+		endpoint = defaultSTSEndpoint
+	}
+
+	resp, err := sendHTTPRequest(httpClient, true, func() (*http.Request, error) {
+		return http.NewRequest("GET", endpoint, nil)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return clockOffset(resp.Header.Get("Date"), time.Now())
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoctor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusFound)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	config := "---\nendpoints:\n  sts_endpoint: " + server.URL + "\n"
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = runDoctor(doctorInput{ConfigPath: path, Out: &out})
+	if err == nil || !strings.Contains(err.Error(), "1 of 3") {
+		t.Errorf("expected the clock check to fail but got %v", err)
+	}
+
+	if !strings.Contains(out.String(), "1h0m0s ahead of AWS") {
+		t.Errorf("expected the offset in the output but got\n%s", out.String())
+	}
+}
+
+func TestCheckStateKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stateDir := filepath.Join(dir, "state")
+	if check := checkStateKey(stateDir); check.Failed || check.Detail != "missing (created on first use)" {
+		t.Errorf("expected a missing key to pass but got %+v", check)
+	}
+
+	if _, err := os.Stat(stateDir); !os.IsNotExist(err) {
+		t.Error("expected the check to not create the state directory")
+	}
+
+	if _, err := loadStateKey(stateDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if check := checkStateKey(stateDir); check.Failed || check.Detail != stateDir {
+		t.Errorf("expected a valid key to pass but got %+v", check)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(stateDir, stateKeyFilename), []byte("short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if check := checkStateKey(stateDir); !check.Failed {
+		t.Error("expected an invalid key to fail")
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+const (
+	defaultDuration = 3600
+	minDuration     = 900
+
+	// Longest session a role can be configured for, used for max
+	maxRoleDuration = 43200
+
+	// Roles assumed with the credentials of another role are capped at an hour
+	chainedRoleDuration = 3600
+
+	// Console sessions last between 15 minutes and 12 hours
+	minConsoleDuration = 900
+	maxConsoleDuration = 43200
+)
+
+// Roles are configured in whole hours from the console, so a rejected
+// duration is retried an hour shorter at a time as STS does not report the
+// role's maximum
+const durationStep = 3600
+
+// Parse a duration given as seconds, a duration such as 8h or 90m, or max
+// for the longest a role can be assumed for
+func parseDuration(value string) (int, error) {
+	var seconds int
+	switch {
+	case value == "":
+		return defaultDuration, nil
+	case value == "max":
+		return maxRoleDuration, nil
+	default:
+		if n, err := strconv.Atoi(value); err == nil {
+			seconds = n
+		} else {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %s, use seconds, a value such as 8h or 90m, or max", value)
+			}
+			seconds = int(d / time.Second)
+		}
+	}
+
+	if seconds < minDuration || seconds > maxSessionDuration {
+		return 0, fmt.Errorf(
+			"duration %s must be between %s and %s",
+			value,
+			formatDuration(minDuration),
+			formatDuration(maxSessionDuration),
+		)
+	}
+
+	return seconds, nil
+}
+
+// Parse the duration for an alias. Roles can be assumed for at most 12
+// hours, longer durations only apply to MFA sessions and federation tokens,
+// for which max is 36 hours.
+func aliasDuration(value string, alias *Alias) (int, error) {
+	if value == "max" && alias.RoleARN() == "" {
+		return maxSessionDuration, nil
+	}
+
+	duration, err := parseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if alias.RoleARN() != "" && duration > maxRoleDuration {
+		return 0, fmt.Errorf(
+			"duration %s is longer than the %s roles can be assumed for",
+			value,
+			formatDuration(maxRoleDuration),
+		)
+	}
+
+	return duration, nil
+}
+
+// Report whether STS rejected a duration as too long, either for the role
+// or for the limit of all roles
+func durationRejected(err error) (awserr.Error, bool) {
+	aerr, ok := err.(awserr.Error)
+	if !ok || aerr.Code() != "ValidationError" {
+		return nil, false
+	}
+
+	message := aerr.Message()
+	return aerr, strings.Contains(message, "DurationSeconds exceeds") ||
+		(strings.Contains(message, "durationSeconds") && strings.Contains(message, "less than or equal to"))
+}
+
+// Return seconds in the form accepted by parseDuration, such as 1h30m
+func formatDuration(seconds int) string {
+	s := (time.Duration(seconds) * time.Second).String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+
+	return s
+}
+
+// Return the next duration to try when STS rejected the last one as longer
+// than the role allows
+func fallbackDuration(err error, duration int) (int, bool) {
+	aerr, ok := durationRejected(err)
+	if !ok {
+		return 0, false
+	}
+
+	if strings.Contains(aerr.Message(), "role chaining") {
+		return chainedRoleDuration, duration > chainedRoleDuration
+	}
+
+	// Longer than any role allows
+	if duration > maxRoleDuration {
+		return maxRoleDuration, true
+	}
+
+	next := (duration - 1) / durationStep * durationStep
+	return next, next >= chainedRoleDuration
+}
+
+// Run a call requesting a duration, retrying with shorter ones while the
+// role rejects it as too long
+func withDurationFallback(duration int, call func(duration int) error) error {
+	for {
+		err := call(duration)
+
+		next, ok := fallbackDuration(err, duration)
+		if !ok {
+			return err
+		}
+
+		fmt.Fprintf(
+			os.Stderr,
+			"Duration of %s is longer than the role allows, retrying with %s\n",
+			formatDuration(duration),
+			formatDuration(next),
+		)
+		duration = next
+	}
+}
+
+// Check that a duration is within the console's limits
+func checkConsoleDuration(requested int) error {
+	if requested < minConsoleDuration || requested > maxConsoleDuration {
+		return fmt.Errorf(
+			"console sessions last between %s and %s, %s was requested",
+			formatDuration(minConsoleDuration),
+			formatDuration(maxConsoleDuration),
+			formatDuration(requested),
+		)
+	}
+
+	return nil
+}
+
+// Return the console session duration for credentials, limited to the
+// console's range and to the time the credentials remain valid
+func consoleDuration(requested int, expiration time.Time) (int, error) {
+	if err := checkConsoleDuration(requested); err != nil {
+		return 0, err
+	}
+
+	if !expiration.IsZero() {
+		remaining := int(time.Until(expiration) / time.Second)
+		if remaining < requested {
+			requested = remaining
+		}
+	}
+
+	if requested < minConsoleDuration {
+		requested = minConsoleDuration
+	}
+
+	return requested, nil
+}
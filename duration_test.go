@@ -0,0 +1,136 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := map[string]int{
+		"":     defaultDuration,
+		"max":  maxRoleDuration,
+		"7200": 7200,
+		"8h":   28800,
+		"90m":  5400,
+	}
+
+	for value, expected := range tests {
+		seconds, err := parseDuration(value)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", value, err)
+		} else if seconds != expected {
+			t.Errorf("expected %d for %q but got %d", expected, value, seconds)
+		}
+	}
+
+	for _, value := range []string{"10m", "48h", "soon"} {
+		if _, err := parseDuration(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+
+	if s := formatDuration(5400); s != "1h30m" {
+		t.Errorf("expected 1h30m but got %s", s)
+	}
+}
+
+func TestDurationFallback(t *testing.T) {
+	tooLong := awserr.New("ValidationError", "The requested DurationSeconds exceeds the MaxSessionDuration set for this role.", nil)
+
+	var tried []int
+	err := withDurationFallback(maxRoleDuration, func(duration int) error {
+		tried = append(tried, duration)
+		if duration > 7200 {
+			return tooLong
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tried) != 11 || tried[1] != 39600 || tried[len(tried)-1] != 7200 {
+		t.Errorf("unexpected durations tried %v", tried)
+	}
+
+	// A role limited to 10 hours gets 10 hours rather than the next lower step
+	tried = nil
+	err = withDurationFallback(maxRoleDuration, func(duration int) error {
+		tried = append(tried, duration)
+		if duration > 36000 {
+			return tooLong
+		}
+		return nil
+	})
+	if err != nil || tried[len(tried)-1] != 36000 {
+		t.Errorf("expected to settle on 10h but tried %v, %v", tried, err)
+	}
+
+	if next, ok := fallbackDuration(tooLong, 5400); !ok || next != 3600 {
+		t.Errorf("expected a 1h30m request to fall back to 1h but got %d", next)
+	}
+
+	chained := awserr.New("ValidationError", "The requested DurationSeconds exceeds the 1 hour session limit for roles assumed by role chaining.", nil)
+	if next, ok := fallbackDuration(chained, 28800); !ok || next != chainedRoleDuration {
+		t.Errorf("expected fallback to %d but got %d", chainedRoleDuration, next)
+	}
+
+	if _, ok := fallbackDuration(tooLong, 3600); ok {
+		t.Error("expected no fallback below an hour")
+	}
+}
+
+func TestAliasDuration(t *testing.T) {
+	role := &Alias{AccountNumber: 123456789012, Role: "Administrator"}
+	if _, err := aliasDuration("20h", role); err == nil {
+		t.Error("expected error for a role alias with 20h")
+	}
+
+	if seconds, err := aliasDuration("12h", role); err != nil || seconds != maxRoleDuration {
+		t.Errorf("expected %d for a role alias with 12h but got %d, %v", maxRoleDuration, seconds, err)
+	}
+
+	if seconds, err := aliasDuration("max", role); err != nil || seconds != maxRoleDuration {
+		t.Errorf("expected max to be %d for a role alias but got %d, %v", maxRoleDuration, seconds, err)
+	}
+
+	for _, alias := range []*Alias{{AccountNumber: 123456789012}, {AccountNumber: 123456789012, Federation: true}} {
+		if seconds, err := aliasDuration("20h", alias); err != nil || seconds != 72000 {
+			t.Errorf("expected 72000 without a role but got %d, %v", seconds, err)
+		}
+
+		if seconds, err := aliasDuration("max", alias); err != nil || seconds != maxSessionDuration {
+			t.Errorf("expected max to be %d without a role but got %d, %v", maxSessionDuration, seconds, err)
+		}
+	}
+
+	constraint := awserr.New(
+		"ValidationError",
+		"1 validation error detected: Value '72000' at 'durationSeconds' failed to satisfy constraint: Member must have value less than or equal to 43200",
+		nil,
+	)
+	if next, ok := fallbackDuration(constraint, 72000); !ok || next != maxRoleDuration {
+		t.Errorf("expected fallback to %d but got %d", maxRoleDuration, next)
+	}
+
+	if d := diagnoseError(constraint); d == nil || d.ExitCode != exitDurationTooLong {
+		t.Errorf("expected a duration diagnosis but got %v", d)
+	}
+}
+
+func TestConsoleDuration(t *testing.T) {
+	if _, err := consoleDuration(maxSessionDuration, time.Time{}); err == nil {
+		t.Error("expected error for a duration longer than the console allows")
+	}
+
+	duration, err := consoleDuration(maxConsoleDuration, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if duration > 3600 || duration < 3500 {
+		t.Errorf("expected the console session to end with the credentials but got %d", duration)
+	}
+}
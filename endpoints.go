@@ -0,0 +1,195 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const (
+	defaultFederationEndpoint = "https://signin.aws.amazon.com/federation"
+
+	// Region used to sign requests to a custom STS endpoint
+	defaultSTSSigningRegion = "us-east-1"
+)
+
+// Network settings for reaching AWS, set globally and overridden per account
+type EndpointConfig struct {
+	STSEndpoint        string `yaml:"sts_endpoint"`
+	STSRegion          string `yaml:"sts_region"`
+	STSFIPS            bool   `yaml:"sts_fips"`
+	FederationEndpoint string `yaml:"federation_endpoint"`
+	IAMEndpoint        string `yaml:"iam_endpoint"`
+	HTTPSProxy         string `yaml:"https_proxy"`
+	CABundle           string `yaml:"ca_bundle"`
+}
+
+// Return the settings with any fields set in override replacing them
+func (e EndpointConfig) merge(override *EndpointConfig) EndpointConfig {
+	if override == nil {
+		return e
+	}
+
+	if override.STSEndpoint != "" {
+		e.STSEndpoint = override.STSEndpoint
+	}
+	if override.STSRegion != "" {
+		e.STSRegion = override.STSRegion
+	}
+	if override.STSFIPS {
+		e.STSFIPS = true
+	}
+	if override.FederationEndpoint != "" {
+		e.FederationEndpoint = override.FederationEndpoint
+	}
+	if override.IAMEndpoint != "" {
+		e.IAMEndpoint = override.IAMEndpoint
+	}
+	if override.HTTPSProxy != "" {
+		e.HTTPSProxy = override.HTTPSProxy
+	}
+	if override.CABundle != "" {
+		e.CABundle = override.CABundle
+	}
+
+	return e
+}
+
+// Check that the proxy and CA bundle can be used
+func (e *EndpointConfig) validate() error {
+	if e.STSFIPS && e.STSRegion == "" {
+		return fmt.Errorf("sts_fips requires sts_region")
+	}
+
+	_, err := e.httpClient()
+	return err
+}
+
+// Return the STS endpoint URL, empty to use the SDK default
+func (e *EndpointConfig) stsEndpoint() string {
+	switch {
+	case e == nil:
+		return ""
+	case e.STSEndpoint != "":
+		return strings.TrimSuffix(e.STSEndpoint, "/")
+	case e.STSFIPS:
+		return fmt.Sprintf("https://sts-fips.%s.amazonaws.com", e.STSRegion)
+	case e.STSRegion != "":
+		return fmt.Sprintf("https://sts.%s.amazonaws.com", e.STSRegion)
+	}
+
+	return ""
+}
+
+func (e *EndpointConfig) federationEndpoint() string {
+	if e == nil || e.FederationEndpoint == "" {
+		return defaultFederationEndpoint
+	}
+
+	return e.FederationEndpoint
+}
+
+// Return the IAM endpoint URL and signing region. IAM has one endpoint per
+// partition, taken from sts_region unless iam_endpoint is set.
+func (e *EndpointConfig) iamEndpoint() (string, string) {
+	endpoint, region := defaultIAMEndpoint, defaultIAMRegion
+	if e == nil {
+		return endpoint, region
+	}
+
+	switch {
+	case strings.HasPrefix(e.STSRegion, "us-gov-"):
+		endpoint, region = "https://iam.us-gov.amazonaws.com/", "us-gov-west-1"
+	case strings.HasPrefix(e.STSRegion, "cn-"):
+		endpoint, region = "https://iam.cn-north-1.amazonaws.com.cn/", "cn-north-1"
+	}
+
+	if e.IAMEndpoint != "" {
+		endpoint = e.IAMEndpoint
+	}
+
+	return endpoint, region
+}
+
+// Return an HTTP client using the configured proxy and trusting the CA
+// bundle in addition to the system roots
+func (e *EndpointConfig) httpClient() (*http.Client, error) {
+	if e == nil || (e.HTTPSProxy == "" && e.CABundle == "") {
+		return http.DefaultClient, nil
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+	}
+
+	if e.HTTPSProxy != "" {
+		proxy, err := url.Parse(e.HTTPSProxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid https_proxy %s: %s", e.HTTPSProxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if e.CABundle != "" {
+		pem, err := ioutil.ReadFile(e.CABundle)
+		if err != nil {
+			return nil, err
+		}
+
+		roots, err := x509.SystemCertPool()
+		if err != nil || roots == nil {
+			roots = x509.NewCertPool()
+		}
+
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_bundle %s does not contain any PEM certificates", e.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// Return an STS client for the credentials using the configured endpoint
+func newSTSClient(creds *credentials.Credentials, endpoints *EndpointConfig) (*sts.STS, error) {
+	client, err := endpoints.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &aws.Config{
+		Credentials: creds,
+		HTTPClient:  client,
+		MaxRetries:  aws.Int(requestMaxRetries),
+	}
+
+	if endpoint := endpoints.stsEndpoint(); endpoint != "" {
+		region := endpoints.STSRegion
+		if region == "" {
+			region = defaultSTSSigningRegion
+		}
+
+		config.Endpoint = aws.String(endpoint)
+		config.Region = aws.String(region)
+	}
+
+	svc := sts.New(session.New(config))
+	svc.Handlers.Send.PushBack(func(r *request.Request) {
+		if r.HTTPResponse != nil {
+			recordClockSkew(r.HTTPResponse.Header, time.Now())
+		}
+	})
+
+	return svc, nil
+}
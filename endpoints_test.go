@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestEndpointConfigMerge(t *testing.T) {
+	global := EndpointConfig{
+		STSRegion:  "us-west-2",
+		HTTPSProxy: "http://proxy.example.com:3128",
+	}
+
+	merged := global.merge(&EndpointConfig{STSRegion: "eu-west-1", STSFIPS: true})
+	if merged.STSRegion != "eu-west-1" || !merged.STSFIPS || merged.HTTPSProxy != global.HTTPSProxy {
+		t.Errorf("unexpected merged settings %+v", merged)
+	}
+
+	if endpoint := merged.stsEndpoint(); endpoint != "https://sts-fips.eu-west-1.amazonaws.com" {
+		t.Errorf("unexpected fips endpoint %s", endpoint)
+	}
+
+	if endpoint := global.stsEndpoint(); endpoint != "https://sts.us-west-2.amazonaws.com" {
+		t.Errorf("unexpected regional endpoint %s", endpoint)
+	}
+
+	var unset *EndpointConfig
+	if unset.stsEndpoint() != "" || unset.federationEndpoint() != defaultFederationEndpoint {
+		t.Error("expected the default endpoints for unset settings")
+	}
+
+	if err := (&EndpointConfig{STSFIPS: true}).validate(); err == nil {
+		t.Error("expected error for sts_fips without sts_region")
+	}
+
+	if err := (&EndpointConfig{CABundle: "/nonexistent/ca.pem"}).validate(); err == nil {
+		t.Error("expected error for a missing ca_bundle")
+	}
+}
+
+func TestIAMEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoints *EndpointConfig
+		endpoint  string
+		region    string
+	}{
+		{nil, "https://iam.amazonaws.com/", "us-east-1"},
+		{&EndpointConfig{STSRegion: "eu-west-1"}, "https://iam.amazonaws.com/", "us-east-1"},
+		{&EndpointConfig{STSRegion: "us-gov-east-1"}, "https://iam.us-gov.amazonaws.com/", "us-gov-west-1"},
+		{&EndpointConfig{STSRegion: "cn-northwest-1"}, "https://iam.cn-north-1.amazonaws.com.cn/", "cn-north-1"},
+		{&EndpointConfig{IAMEndpoint: "http://localhost:4566"}, "http://localhost:4566", "us-east-1"},
+	}
+
+	for _, test := range tests {
+		endpoint, region := test.endpoints.iamEndpoint()
+		if endpoint != test.endpoint || region != test.region {
+			t.Errorf("expected %s in %s for %+v but got %s in %s", test.endpoint, test.region, test.endpoints, endpoint, region)
+		}
+	}
+}
+
+func TestSTSClientEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("Action") != "GetSessionToken" || !strings.Contains(r.Header.Get("Authorization"), "/eu-west-1/sts/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Write([]byte(`<GetSessionTokenResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetSessionTokenResult>
+    <Credentials>
+      <AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>2030-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </GetSessionTokenResult>
+</GetSessionTokenResponse>`))
+	}))
+	defer server.Close()
+
+	creds, err := getSessionToken(sessionTokenInput{
+		Credentials:    credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""),
+		AWSAccessKeyID: "AKIAEXAMPLE",
+		StateDir:       "unused",
+		Endpoints:      &EndpointConfig{STSEndpoint: server.URL + "/", STSRegion: "eu-west-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if creds.AccessKeyID != "ASIAEXAMPLE" || creds.Expiration.Year() != 2030 {
+		t.Errorf("unexpected credentials %+v", creds)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Returned when a command run by exec or shell exits with a non-zero code,
+// which aws-session exits with in turn
+type commandExitError struct {
+	code int
+}
+
+func (e *commandExitError) Error() string {
+	return fmt.Sprintf("command exited with code %d", e.code)
+}
+
+// Refuse to run inside a shell or command that already has credentials
+// from aws-session, since the inner alias would silently replace them
+func checkNesting(force bool) error {
+	if name := os.Getenv("AWS_ACCOUNT_NAME"); name != "" && !force {
+		return fmt.Errorf("credentials for %s are already set in this environment, exit that shell first or use --force", name)
+	}
+
+	return nil
+}
+
+// Run a command with the environment, forwarding signals sent to
+// aws-session and returning a commandExitError when it fails
+func runWithCredentials(command []string, env []string) error {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Interrupts are caught so they stop the command and not aws-session
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{os.Interrupt}, forwardedSignals...)...)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig != os.Interrupt {
+					cmd.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	if err == nil {
+		return nil
+	}
+
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return err
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return err
+	}
+
+	// Shells report commands killed by a signal as 128 plus the signal
+	if status.Signaled() {
+		return &commandExitError{code: 128 + int(status.Signal())}
+	}
+
+	return &commandExitError{code: status.ExitStatus()}
+}
+
+// Return the command and environment starting the user's shell with its
+// prompt marked with the alias, and a function removing any files it
+// needed. Bash and zsh read the marker from rc files run after the user's
+// own, which would otherwise replace it, and fish from a command run after
+// its config. Other shells read it from PS1, or PROMPT for cmd.
+func shellInvocation(shell, alias string, env []string) ([]string, []string, func(), error) {
+	marker := fmt.Sprintf("(aws:%s) ", alias)
+	name := strings.TrimSuffix(strings.ToLower(filepath.Base(shell)), ".exe")
+
+	switch name {
+	case "bash":
+		rc, err := ioutil.TempFile("", "aws-session-rc")
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		defer rc.Close()
+
+		script := fmt.Sprintf("[ -f ~/.bashrc ] && . ~/.bashrc\nPS1=%s\"$PS1\"\n", shellQuote(marker))
+		if _, err := rc.WriteString(script); err != nil {
+			os.Remove(rc.Name())
+			return nil, nil, nil, err
+		}
+
+		cleanup := func() { os.Remove(rc.Name()) }
+		return []string{shell, "--rcfile", rc.Name(), "-i"}, env, cleanup, nil
+	case "zsh":
+		dir, err := zshRCDir(marker)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		cleanup := func() { os.RemoveAll(dir) }
+		return []string{shell}, commandEnv(env, []string{"ZDOTDIR=" + dir}), cleanup, nil
+	case "fish":
+		quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(marker)
+		init := "functions --copy fish_prompt __aws_session_prompt\n" +
+			"function fish_prompt\n" +
+			"    echo -n '" + quoted + "'\n" +
+			"    __aws_session_prompt\n" +
+			"end"
+
+		return []string{shell, "--init-command", init}, env, func() {}, nil
+	case "cmd":
+		return []string{shell}, append(env, "PROMPT="+marker+"$P$G"), func() {}, nil
+	}
+
+	ps1 := os.Getenv("PS1")
+	if ps1 == "" {
+		ps1 = "$ "
+	}
+
+	return []string{shell}, append(env, "PS1="+marker+ps1), func() {}, nil
+}
+
+// Return a directory for ZDOTDIR whose startup files run the user's own
+// and then mark the prompt. The user's ZDOTDIR is restored for their files,
+// which may set it to another directory in .zshenv.
+func zshRCDir(marker string) (string, error) {
+	dir, err := ioutil.TempDir("", "aws-session-zsh")
+	if err != nil {
+		return "", err
+	}
+
+	userDir := `"$HOME"`
+	if zdotdir := os.Getenv("ZDOTDIR"); zdotdir != "" {
+		userDir = shellQuote(zdotdir)
+	}
+
+	files := map[string]string{
+		".zshenv": fmt.Sprintf(
+			"ZDOTDIR=%s\n"+
+				"[ -f \"$ZDOTDIR/.zshenv\" ] && . \"$ZDOTDIR/.zshenv\"\n"+
+				"__aws_session_zdotdir=$ZDOTDIR\n"+
+				"ZDOTDIR=%s\n",
+			userDir,
+			shellQuote(dir),
+		),
+		".zshrc": fmt.Sprintf(
+			"ZDOTDIR=$__aws_session_zdotdir\n"+
+				"unset __aws_session_zdotdir\n"+
+				"[ -f \"$ZDOTDIR/.zshrc\" ] && . \"$ZDOTDIR/.zshrc\"\n"+
+				"PROMPT=%s\"$PROMPT\"\n",
+			shellQuote(marker),
+		),
+	}
+
+	for name, script := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0600); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+
+	return dir, nil
+}
+
+// Quote a string in single quotes for bash and zsh, which expand nothing
+// inside them. A single quote ends the string, is escaped and starts it
+// again.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunWithCredentials(t *testing.T) {
+	err := runWithCredentials([]string{"sh", "-c", "exit 4"}, os.Environ())
+	if exitErr, ok := err.(*commandExitError); !ok || exitErr.code != 4 {
+		t.Errorf("expected exit code 4 but got %v", err)
+	}
+
+	if err := runWithCredentials([]string{"true"}, os.Environ()); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+}
+
+func TestCheckNesting(t *testing.T) {
+	defer os.Setenv("AWS_ACCOUNT_NAME", os.Getenv("AWS_ACCOUNT_NAME"))
+
+	os.Setenv("AWS_ACCOUNT_NAME", "prod")
+	if err := checkNesting(false); err == nil {
+		t.Error("expected error with credentials already set")
+	}
+
+	if err := checkNesting(true); err != nil {
+		t.Errorf("expected force to allow nesting but got %s", err)
+	}
+}
+
+func TestShellInvocation(t *testing.T) {
+	command, _, cleanup, err := shellInvocation("/bin/bash", "prod", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rc, err := ioutil.ReadFile(command[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(rc), `PS1='(aws:prod) '"$PS1"`) {
+		t.Errorf("expected the rc file to mark the prompt but got\n%s", rc)
+	}
+
+	cleanup()
+	if _, err := os.Stat(command[2]); !os.IsNotExist(err) {
+		t.Error("expected the rc file to be removed")
+	}
+
+	_, env, _, err := shellInvocation("/bin/dash", "prod", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(env) != 1 || !strings.HasPrefix(env[0], "PS1=(aws:prod) ") {
+		t.Errorf("expected a marked PS1 but got %v", env)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, value := range []string{"(aws:prod) ", "(aws:it's) ", `$HOME "x" \n $(id) ` + "`id`"} {
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(value)).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(out) != value {
+			t.Errorf("expected %q but the shell printed %q", value, out)
+		}
+	}
+}
+
+func TestShellInvocation_zsh(t *testing.T) {
+	command, env, cleanup, err := shellInvocation("/usr/bin/zsh", "prod", []string{"ZDOTDIR=/old", "HOME=/home/jim"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	if len(command) != 1 || len(env) != 2 || env[0] != "HOME=/home/jim" || !strings.HasPrefix(env[1], "ZDOTDIR=") {
+		t.Fatalf("expected zsh to start with a new ZDOTDIR but got %v %v", command, env)
+	}
+	dir := strings.TrimPrefix(env[1], "ZDOTDIR=")
+
+	rc, err := ioutil.ReadFile(filepath.Join(dir, ".zshrc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sourced := strings.Index(string(rc), `. "$ZDOTDIR/.zshrc"`)
+	marked := strings.Index(string(rc), `PROMPT='(aws:prod) '"$PROMPT"`)
+	if sourced < 0 || marked < sourced {
+		t.Errorf("expected the user's .zshrc to run before the prompt is marked but got\n%s", rc)
+	}
+
+	if strings.Contains(strings.Join(env, " "), "PS1") {
+		t.Error("expected PS1 to be left to the user's .zshrc")
+	}
+
+	cleanup()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("expected the ZDOTDIR to be removed")
+	}
+}
+
+func TestShellInvocation_fish(t *testing.T) {
+	command, env, _, err := shellInvocation("/usr/bin/fish", "it's", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(env) != 0 || len(command) != 3 || command[1] != "--init-command" {
+		t.Fatalf("expected fish to mark the prompt with an init command but got %v %v", command, env)
+	}
+
+	if !strings.Contains(command[2], `echo -n '(aws:it\'s) '`) {
+		t.Errorf("expected the quoted marker in\n%s", command[2])
+	}
+}
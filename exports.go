@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var exportPrefixPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+// Alias requested with --alias, its variables named with the prefix when
+// one is given
+type aliasExport struct {
+	Prefix string
+	Name   string
+}
+
+// Return the namespace prepended to variable names, such as SRC_
+func (e aliasExport) namespace() string {
+	if e.Prefix == "" {
+		return ""
+	}
+
+	return strings.ToUpper(e.Prefix) + "_"
+}
+
+// Parse alias flag values of the form alias or prefix=alias. Only one
+// alias can be exported without a prefix and prefixes must be unique.
+func parseAliasExports(values []string) ([]aliasExport, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("alias flag can not be empty")
+	}
+
+	exports := make([]aliasExport, len(values))
+	seen := make(map[string]bool)
+
+	for i, value := range values {
+		var export aliasExport
+		if parts := strings.SplitN(value, "=", 2); len(parts) == 2 {
+			export = aliasExport{Prefix: parts[0], Name: parts[1]}
+			if !exportPrefixPattern.MatchString(export.Prefix) {
+				return nil, fmt.Errorf("alias prefix %s must be a letter followed by letters, digits or underscores", export.Prefix)
+			}
+		} else {
+			export = aliasExport{Name: value}
+		}
+
+		if export.Name == "" {
+			return nil, fmt.Errorf("alias flag can not be empty")
+		}
+
+		namespace := export.namespace()
+		if seen[namespace] {
+			if namespace == "" {
+				return nil, fmt.Errorf("only one alias can be exported without a prefix")
+			}
+			return nil, fmt.Errorf("alias prefix %s is used more than once", export.Prefix)
+		}
+		seen[namespace] = true
+
+		exports[i] = export
+	}
+
+	return exports, nil
+}
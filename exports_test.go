@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseAliasExports(t *testing.T) {
+	exports, err := parseAliasExports([]string{"src=prod-read", "dst=backup-admin", "sandbox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"SRC_", "DST_", ""}
+	for i, export := range exports {
+		if export.namespace() != expected[i] {
+			t.Errorf("expected namespace %q for %s but got %q", expected[i], export.Name, export.namespace())
+		}
+	}
+
+	invalid := [][]string{
+		nil,
+		{"prod", "sandbox"},
+		{"src=prod", "SRC=sandbox"},
+		{"1st=prod"},
+		{"src="},
+	}
+
+	for _, values := range invalid {
+		if _, err := parseAliasExports(values); err == nil {
+			t.Errorf("expected error for %v", values)
+		}
+	}
+}
+
+func TestNamespacedEnvOut(t *testing.T) {
+	out, err := envOut(&sessionCredentials{AccessKeyID: "ASIAEXAMPLE"}, envOutInput{
+		Region:    "us-west-2",
+		UserShell: "bash",
+		Namespace: "SRC_",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if !strings.HasPrefix(line, "export SRC_AWS_") && !strings.HasPrefix(line, "unset SRC_AWS_") {
+			t.Errorf("expected a namespaced variable but got %q", line)
+		}
+	}
+}
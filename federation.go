@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const (
+	minFederatedUserName = 2
+	maxFederatedUserName = 32
+)
+
+// Return a federated user name STS accepts, replacing invalid characters,
+// padding short names and truncating long ones
+func federatedUserName(name string) string {
+	name = invalidSessionNameChars.ReplaceAllString(name, "-")
+	if len(name) < minFederatedUserName {
+		name += strings.Repeat("-", minFederatedUserName-len(name))
+	}
+
+	if len(name) > maxFederatedUserName {
+		name = name[:maxFederatedUserName]
+	}
+
+	return name
+}
+
+type federationTokenInput struct {
+	Credentials *credentials.Credentials `required:"true"`
+	Name        string                   `required:"true"`
+	Duration    int
+	Policy      string
+	Endpoints   *EndpointConfig
+}
+
+// Request credentials for a federated user of an IAM user's account. Only
+// long-term keys may call GetFederationToken.
+func getFederationToken(input federationTokenInput) (*sessionCredentials, error) {
+	base, err := input.Credentials.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	if base.SessionToken != "" {
+		return nil, fmt.Errorf("federation tokens require long-term access keys")
+	}
+
+	svc, err := newSTSClient(input.Credentials, input.Endpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	stsInput := &sts.GetFederationTokenInput{
+		DurationSeconds: aws.Int64(int64(input.Duration)),
+		Name:            aws.String(federatedUserName(input.Name)),
+	}
+
+	if input.Policy != "" {
+		stsInput.Policy = aws.String(input.Policy)
+	}
+
+	ctx, cancel := newRequestContext()
+	defer cancel()
+
+	result, err := svc.GetFederationTokenWithContext(ctx, stsInput)
+	if err != nil {
+		return nil, requestError(ctx, err)
+	}
+
+	return newSessionCredentials(result.Credentials), nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestFederatedUserName(t *testing.T) {
+	tests := map[string]string{
+		"dev":                                   "dev",
+		"jim@example.com":                       "jim@example.com",
+		"dev team/admin":                        "dev-team-admin",
+		"a+b=c,d.e_f-g":                         "a+b=c,d.e_f-g",
+		"production-account-with-a-long-name":   "production-account-with-a-long-n",
+		"exactly-thirty-two-characters-ok":      "exactly-thirty-two-characters-ok",
+		"über":                                  "-ber",
+		"this name has spaces and is too long!": "this-name-has-spaces-and-is-too-",
+		"a":                                     "a-",
+		"":                                      "--",
+	}
+
+	for name, expected := range tests {
+		if got := federatedUserName(name); got != expected {
+			t.Errorf("expected %q for %q but got %q", expected, name, got)
+		}
+
+		if got := federatedUserName(name); len(got) < minFederatedUserName || len(got) > maxFederatedUserName {
+			t.Errorf("expected %d to %d characters but got %q", minFederatedUserName, maxFederatedUserName, got)
+		}
+	}
+}
+
+func TestLoadConfig_federation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	config := `---
+accounts:
+- aws_access_key_id: 'AKIAEXAMPLE'
+  aws_secret_access_key: 'secret'
+  aliases:
+  - name: billing
+    account_number: 123456789012
+    federation_token: true
+`
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "alias billing sets federation_token without a policy") {
+		t.Errorf("expected error for a federation alias without a policy but got %v", err)
+	}
+
+	config += "    policy: '{\"Version\":\"2012-10-17\",\"Statement\":[]}'\n"
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadConfig(path); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+}
+
+func TestWebOut_federation(t *testing.T) {
+	var federationName, federationDuration string
+	var signinQuery map[string][]string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+
+		switch {
+		case r.URL.Path == "/federation":
+			signinQuery = r.URL.Query()
+			w.Write([]byte(`{"SigninToken":"signin-token"}`))
+		case r.Form.Get("Action") == "GetFederationToken":
+			federationName = r.Form.Get("Name")
+			federationDuration = r.Form.Get("DurationSeconds")
+			fmt.Fprintf(w, `<GetFederationTokenResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetFederationTokenResult>
+    <Credentials>
+      <AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </GetFederationTokenResult>
+</GetFederationTokenResponse>`, time.Now().Add(36*time.Hour).UTC().Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out, err := webOut(webOutInput{roleCredentialsInput{
+		Credentials: credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""),
+		AccountName: "dev team",
+		Federation:  true,
+		StateDir:    dir,
+		Duration:    maxSessionDuration,
+		Cache:       cacheDisabled,
+		Endpoints: &EndpointConfig{
+			STSEndpoint:        server.URL,
+			FederationEndpoint: server.URL + "/federation",
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if federationName != "dev-team" || federationDuration != "129600" {
+		t.Errorf("expected a 36 hour token for dev-team but got %s for %s", federationDuration, federationName)
+	}
+
+	if _, ok := signinQuery["SessionDuration"]; ok {
+		t.Errorf("expected SessionDuration to be omitted for federation tokens but got %v", signinQuery)
+	}
+
+	if !strings.HasSuffix(out, "&SigninToken=signin-token") {
+		t.Errorf("unexpected sign-in URL %s", out)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+const defaultForeachConcurrency = 4
+
+// Alias run by foreach along with the base account it belongs to
+type foreachAlias struct {
+	Name    string
+	Account int
+}
+
+// Return the aliases matching any of the glob patterns, sorted by name
+func matchAliases(config *Config, patterns []string) ([]foreachAlias, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("aliases flag can not be empty")
+	}
+
+	names := config.AliasNames()
+	sort.Strings(names)
+
+	var aliases []foreachAlias
+	for _, name := range names {
+		for _, pattern := range patterns {
+			matched, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid alias pattern %s: %s", pattern, err)
+			}
+
+			if matched {
+				aliases = append(aliases, foreachAlias{
+					Name:    name,
+					Account: config.aliasMap[name].accountIndex,
+				})
+				break
+			}
+		}
+	}
+
+	if len(aliases) == 0 {
+		return nil, fmt.Errorf("no aliases match %s", strings.Join(patterns, ", "))
+	}
+
+	return aliases, nil
+}
+
+// Outcome of running the command for one alias
+type foreachResult struct {
+	Alias    string  `json:"alias"`
+	ExitCode int     `json:"exit_code"`
+	Error    string  `json:"error,omitempty"`
+	Skipped  bool    `json:"skipped,omitempty"`
+	Duration float64 `json:"duration_seconds"`
+	Output   string  `json:"output,omitempty"`
+}
+
+func (r *foreachResult) failed() bool {
+	return r.Skipped || r.Error != "" || r.ExitCode != 0
+}
+
+type foreachInput struct {
+	Aliases []foreachAlias `required:"true"`
+	Command []string       `required:"true"`
+
+	// Return the environment variables holding an alias's credentials
+	Environment func(alias string) ([]string, error)
+
+	Concurrency int
+	FailFast    bool
+	Collect     bool
+	JSON        bool
+	Out         io.Writer
+	ErrOut      io.Writer
+}
+
+// Run the command once per alias with its credentials in the environment.
+// The first alias of each base account gets its credentials before the
+// others start, so each account asks for an MFA token once and the other
+// aliases use its stored session. Output is prefixed with the alias, or
+// collected per alias with Collect or JSON, and followed by a summary.
+func runForeach(input foreachInput) error {
+	if err := Validate(input); err != nil {
+		return err
+	}
+
+	concurrency := input.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultForeachConcurrency
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make([]foreachResult, len(input.Aliases))
+	envs := make([][]string, len(input.Aliases))
+	fetched := make([]bool, len(input.Aliases))
+
+	// Get the credentials for an alias, stopping the rest with FailFast
+	environment := func(i int) {
+		env, err := input.Environment(input.Aliases[i].Name)
+		envs[i], fetched[i] = env, true
+		if err != nil {
+			results[i].Error = err.Error()
+			results[i].ExitCode = -1
+			if input.FailFast {
+				cancel()
+			}
+		}
+	}
+
+	for i := range results {
+		results[i].Alias = input.Aliases[i].Name
+	}
+
+	seen := make(map[int]bool)
+	for i, alias := range input.Aliases {
+		if seen[alias.Account] || ctx.Err() != nil {
+			continue
+		}
+		seen[alias.Account] = true
+		environment(i)
+	}
+
+	var outputLock sync.Mutex
+	width := 0
+	for _, alias := range input.Aliases {
+		if len(alias.Name) > width {
+			width = len(alias.Name)
+		}
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				result := &results[i]
+				if ctx.Err() != nil {
+					result.Skipped, result.ExitCode = true, -1
+					continue
+				}
+
+				if !fetched[i] {
+					environment(i)
+				}
+				if result.Error != "" {
+					continue
+				}
+
+				var collected bytes.Buffer
+				var stdout, stderr io.Writer = &collected, &collected
+				if !input.Collect && !input.JSON {
+					prefix := fmt.Sprintf("[%-*s] ", width, result.Alias)
+					stdout = &prefixWriter{lock: &outputLock, out: input.Out, prefix: prefix}
+					stderr = &prefixWriter{lock: &outputLock, out: input.ErrOut, prefix: prefix}
+				}
+
+				start := time.Now()
+				err := runAliasCommand(ctx, input.Command, envs[i], stdout, stderr)
+				result.Duration = time.Since(start).Seconds()
+				result.ExitCode = exitStatus(err)
+
+				if w, ok := stdout.(*prefixWriter); ok {
+					w.Flush()
+					stderr.(*prefixWriter).Flush()
+				}
+
+				switch {
+				case err == nil:
+				case ctx.Err() != nil:
+					result.Error = "stopped after another alias failed"
+				case result.ExitCode == -1:
+					result.Error = err.Error()
+				}
+
+				if input.FailFast && result.failed() {
+					cancel()
+				}
+
+				if input.JSON {
+					result.Output = collected.String()
+				} else if input.Collect {
+					outputLock.Lock()
+					fmt.Fprintf(input.Out, "==> %s <==\n%s", result.Alias, collected.String())
+					outputLock.Unlock()
+				}
+			}
+		}()
+	}
+
+	for i := range input.Aliases {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if err := writeForeachSummary(input, results); err != nil {
+		return err
+	}
+
+	failed := 0
+	for i := range results {
+		if results[i].failed() {
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d aliases failed", failed, len(results))
+	}
+
+	return nil
+}
+
+// Print the results as JSON or as a table of exit codes
+func writeForeachSummary(input foreachInput, results []foreachResult) error {
+	if input.JSON {
+		encoder := json.NewEncoder(input.Out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(results)
+	}
+
+	w := tabwriter.NewWriter(input.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "\nALIAS\tEXIT\tDURATION\tERROR")
+
+	for _, result := range results {
+		exit, errorText := fmt.Sprint(result.ExitCode), result.Error
+		if result.Skipped {
+			exit, errorText = "-", "skipped"
+		}
+
+		fmt.Fprintf(
+			w,
+			"%s\t%s\t%s\t%s\n",
+			result.Alias,
+			exit,
+			time.Duration(result.Duration*float64(time.Second)).Round(time.Millisecond),
+			errorText,
+		)
+	}
+
+	return w.Flush()
+}
+
+// Run a command with credential variables replacing any inherited ones
+func runAliasCommand(ctx context.Context, command []string, env []string, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = commandEnv(os.Environ(), env)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	return cmd.Run()
+}
+
+// Return the base environment with the variables set. Blank variables
+// remove inherited ones, such as the session token of other credentials.
+func commandEnv(base []string, vars []string) []string {
+	replaced := make(map[string]bool)
+	for _, v := range vars {
+		replaced[strings.SplitN(v, "=", 2)[0]] = true
+	}
+
+	var env []string
+	for _, v := range base {
+		if !replaced[strings.SplitN(v, "=", 2)[0]] {
+			env = append(env, v)
+		}
+	}
+
+	for _, v := range vars {
+		if !strings.HasSuffix(v, "=") {
+			env = append(env, v)
+		}
+	}
+
+	return env
+}
+
+// Return the exit code of a command, -1 when it did not start or exit
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+			return status.ExitStatus()
+		}
+	}
+
+	return -1
+}
+
+// Writer prefixing each line, writing whole lines so output of concurrent
+// commands is not interleaved within a line
+type prefixWriter struct {
+	lock   *sync.Mutex
+	out    io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.writeLine(w.buf[:i+1])
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+// Write any partial line left once the command exits
+func (w *prefixWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.writeLine(append(w.buf, '\n'))
+		w.buf = nil
+	}
+}
+
+func (w *prefixWriter) writeLine(line []byte) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	fmt.Fprintf(w.out, "%s%s", w.prefix, line)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRunForeach(t *testing.T) {
+	var lock sync.Mutex
+	var fetched []string
+
+	environment := func(alias string) ([]string, error) {
+		lock.Lock()
+		fetched = append(fetched, alias)
+		lock.Unlock()
+
+		if alias == "broken" {
+			return nil, fmt.Errorf("no credentials")
+		}
+		return []string{"AWS_ACCOUNT_NAME=" + alias, "AWS_SESSION_TOKEN="}, nil
+	}
+
+	aliases := []foreachAlias{
+		{Name: "dev", Account: 0},
+		{Name: "prod", Account: 0},
+		{Name: "broken", Account: 1},
+	}
+
+	var out bytes.Buffer
+	err := runForeach(foreachInput{
+		Aliases:     aliases,
+		Command:     []string{"sh", "-c", `echo "$AWS_ACCOUNT_NAME ${AWS_SESSION_TOKEN-unset}"; test "$AWS_ACCOUNT_NAME" = dev`},
+		Environment: environment,
+		JSON:        true,
+		Out:         &out,
+	})
+	if err == nil || err.Error() != "2 of 3 aliases failed" {
+		t.Errorf("expected 2 failed aliases but got %v", err)
+	}
+
+	// The first alias of each account gets credentials before the others
+	if len(fetched) != 3 || fetched[0] != "dev" || fetched[1] != "broken" {
+		t.Errorf("expected dev and broken first but got %v", fetched)
+	}
+
+	var results []foreachResult
+	if err := json.Unmarshal(out.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		exitCode int
+		output   string
+	}{
+		{0, "dev unset\n"},
+		{1, "prod unset\n"},
+		{-1, ""},
+	}
+
+	for i, result := range results {
+		if result.ExitCode != expected[i].exitCode || result.Output != expected[i].output {
+			t.Errorf("unexpected result for %s: %+v", result.Alias, result)
+		}
+	}
+}
+
+func TestRunForeachFailFast(t *testing.T) {
+	aliases := []foreachAlias{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	environment := func(alias string) ([]string, error) {
+		return []string{"AWS_ACCOUNT_NAME=" + alias}, nil
+	}
+
+	var out bytes.Buffer
+	err := runForeach(foreachInput{
+		Aliases:     aliases,
+		Command:     []string{"sh", "-c", "echo failing; exit 3"},
+		Environment: environment,
+		Concurrency: 1,
+		FailFast:    true,
+		Out:         &out,
+		ErrOut:      &out,
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "[a] failing\n") || strings.Contains(output, "[b]") {
+		t.Errorf("expected only a to run but got\n%s", output)
+	}
+
+	if strings.Count(output, "skipped") != 2 {
+		t.Errorf("expected skipped aliases in the summary but got\n%s", output)
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	env := commandEnv(
+		[]string{"HOME=/home/jim", "AWS_SESSION_TOKEN=old", "AWS_ACCESS_KEY_ID=old"},
+		[]string{"AWS_ACCESS_KEY_ID=AKIAEXAMPLE", "AWS_SESSION_TOKEN="},
+	)
+
+	expected := "HOME=/home/jim AWS_ACCESS_KEY_ID=AKIAEXAMPLE"
+	if strings.Join(env, " ") != expected {
+		t.Errorf("expected %s but got %v", expected, env)
+	}
+}
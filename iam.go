@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+// The vendored SDK does not include the IAM client, so the few access key
+// actions used for rotation are sent as signed query requests
+const (
+	defaultIAMEndpoint = "https://iam.amazonaws.com/"
+	defaultIAMRegion   = "us-east-1"
+	iamAPIVersion      = "2010-05-08"
+)
+
+type iamAccessKey struct {
+	AccessKeyID     string    `xml:"AccessKeyId"`
+	SecretAccessKey string    `xml:"SecretAccessKey"`
+	Status          string    `xml:"Status"`
+	CreateDate      time.Time `xml:"CreateDate"`
+}
+
+type iamAccessKeyLastUsed struct {
+	LastUsedDate time.Time `xml:"LastUsedDate"`
+	ServiceName  string    `xml:"ServiceName"`
+	Region       string    `xml:"Region"`
+}
+
+type iamError struct {
+	StatusCode int
+	Code       string `xml:"Error>Code"`
+	Message    string `xml:"Error>Message"`
+}
+
+func (e *iamError) Error() string {
+	return fmt.Sprintf("iam request failed (%d): %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Client for the access key actions of the calling IAM user
+type iamClient struct {
+	credentials *credentials.Credentials
+	endpoint    string
+	region      string
+	httpClient  *http.Client
+}
+
+func newIAMClient(creds *credentials.Credentials, httpClient *http.Client, endpoints *EndpointConfig) *iamClient {
+	endpoint, region := endpoints.iamEndpoint()
+	return &iamClient{credentials: creds, endpoint: endpoint, region: region, httpClient: httpClient}
+}
+
+// Send an action and decode its XML response
+func (c *iamClient) call(action string, params url.Values, out interface{}) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("Action", action)
+	params.Set("Version", iamAPIVersion)
+
+	// A retried CreateAccessKey could leave behind a key nobody knows about
+	retry := action != "CreateAccessKey"
+
+	resp, err := sendHTTPRequest(c.httpClient, retry, func() (*http.Request, error) {
+		body := strings.NewReader(params.Encode())
+		req, err := http.NewRequest("POST", c.endpoint, body)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+		signer := v4.NewSigner(c.credentials)
+		if _, err := signer.Sign(req, body, "iam", c.region, time.Now()); err != nil {
+			return nil, err
+		}
+
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		iamErr := &iamError{StatusCode: resp.StatusCode}
+		if err := xml.Unmarshal(resp.Body, iamErr); err != nil {
+			iamErr.Code = http.StatusText(resp.StatusCode)
+		}
+		return iamErr
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return xml.Unmarshal(resp.Body, out)
+}
+
+func (c *iamClient) ListAccessKeys() ([]iamAccessKey, error) {
+	var out struct {
+		Keys []iamAccessKey `xml:"ListAccessKeysResult>AccessKeyMetadata>member"`
+	}
+
+	if err := c.call("ListAccessKeys", nil, &out); err != nil {
+		return nil, err
+	}
+
+	return out.Keys, nil
+}
+
+func (c *iamClient) CreateAccessKey() (*iamAccessKey, error) {
+	var out struct {
+		Key iamAccessKey `xml:"CreateAccessKeyResult>AccessKey"`
+	}
+
+	if err := c.call("CreateAccessKey", nil, &out); err != nil {
+		return nil, err
+	}
+
+	return &out.Key, nil
+}
+
+func (c *iamClient) GetAccessKeyLastUsed(accessKeyID string) (*iamAccessKeyLastUsed, error) {
+	var out struct {
+		LastUsed iamAccessKeyLastUsed `xml:"GetAccessKeyLastUsedResult>AccessKeyLastUsed"`
+	}
+
+	params := url.Values{}
+	params.Set("AccessKeyId", accessKeyID)
+	if err := c.call("GetAccessKeyLastUsed", params, &out); err != nil {
+		return nil, err
+	}
+
+	return &out.LastUsed, nil
+}
+
+func (c *iamClient) UpdateAccessKey(accessKeyID, status string) error {
+	params := url.Values{}
+	params.Set("AccessKeyId", accessKeyID)
+	params.Set("Status", status)
+
+	return c.call("UpdateAccessKey", params, nil)
+}
+
+func (c *iamClient) DeleteAccessKey(accessKeyID string) error {
+	params := url.Values{}
+	params.Set("AccessKeyId", accessKeyID)
+
+	return c.call("DeleteAccessKey", params, nil)
+}
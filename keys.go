@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const (
+	defaultKeyMaxAgeDays = 90
+
+	// New access keys can take a few seconds to be accepted by STS
+	keyVerifyTimeout  = 30 * time.Second
+	keyVerifyInterval = 2 * time.Second
+)
+
+// Report whether the account authenticates with long-term access keys
+func (a *Account) hasStaticKeys() bool {
+	return a.Source == "" && a.AWSAccessKeyId != "" && a.AWSSessionToken == ""
+}
+
+// Return the credentials used for IAM calls on an account's keys. Users
+// with an MFA device use the MFA session since IAM policies commonly
+// require MFA for managing keys.
+func keyManagementCredentials(account *Account, stateDir string, token mfaToken, lock lockOptions, endpoints *EndpointConfig) (*credentials.Credentials, error) {
+	base := credentials.NewStaticCredentials(account.AWSAccessKeyId, account.AWSSecretAccessKey, "")
+	deviceID := account.DefaultMFADevice()
+	if deviceID == "" {
+		return base, nil
+	}
+
+	creds, err := mfaSession(sessionTokenInput{
+		Credentials:    base,
+		AWSAccessKeyID: account.AWSAccessKeyId,
+		MFADeviceID:    deviceID,
+		MFAToken:       token,
+		StateDir:       stateDir,
+		Duration:       account.SessionDuration,
+		Lock:           lock,
+		Endpoints:      endpoints,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return creds.provider(), nil
+}
+
+// Wait for a new access key to authenticate with STS
+func verifyAccessKey(key *iamAccessKey, endpoints *EndpointConfig) error {
+	svc, err := newSTSClient(
+		credentials.NewStaticCredentials(key.AccessKeyID, key.SecretAccessKey, ""),
+		endpoints,
+	)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(keyVerifyTimeout)
+	for {
+		ctx, cancel := newRequestContext()
+		_, err := svc.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+		err = requestError(ctx, err)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		aerr, ok := err.(awserr.Error)
+		if !ok || aerr.Code() != "InvalidClientTokenId" || time.Now().After(deadline) {
+			return fmt.Errorf("new access key %s failed verification: %s", key.AccessKeyID, err)
+		}
+
+		time.Sleep(keyVerifyInterval)
+	}
+}
+
+// Replace the old key in the configuration file, writing a temporary file
+// and renaming it over the original so the file is never left half written.
+// Only the key values change, keeping the rest of the file as it was.
+func replaceConfigKey(path string, old, new *Account) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range []string{old.AWSAccessKeyId, old.AWSSecretAccessKey} {
+		if !bytes.Contains(b, []byte(value)) {
+			return fmt.Errorf("unable to find the current access key in %s", path)
+		}
+	}
+
+	b = bytes.Replace(b, []byte(old.AWSAccessKeyId), []byte(new.AWSAccessKeyId), -1)
+	b = bytes.Replace(b, []byte(old.AWSSecretAccessKey), []byte(new.AWSSecretAccessKey), -1)
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".config-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), info.Mode()); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+type rotateKeyInput struct {
+	Account    *Account `required:"true"`
+	ConfigPath string   `required:"true"`
+	StateDir   string   `required:"true"`
+	MFAToken   mfaToken
+	Lock       lockOptions
+	Endpoints  *EndpointConfig
+	Out        io.Writer
+}
+
+// Replace an account's access key. The new key is created and verified
+// before the configuration is updated, and deleted again if either step
+// fails. The old key is deactivated and deleted only once the configuration
+// refers to the new one.
+func rotateAccessKey(input rotateKeyInput) error {
+	account := input.Account
+	if !account.hasStaticKeys() {
+		return fmt.Errorf("only accounts with long-term access keys can be rotated")
+	}
+
+	httpClient, err := input.Endpoints.httpClient()
+	if err != nil {
+		return err
+	}
+
+	creds, err := keyManagementCredentials(account, input.StateDir, input.MFAToken, input.Lock, input.Endpoints)
+	if err != nil {
+		return err
+	}
+	client := newIAMClient(creds, httpClient, input.Endpoints)
+
+	keys, err := client.ListAccessKeys()
+	if err != nil {
+		return err
+	}
+
+	if len(keys) > 1 {
+		return fmt.Errorf("user already has %d access keys, delete the unused key before rotating", len(keys))
+	}
+
+	newKey, err := client.CreateAccessKey()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(input.Out, "Created access key %s\n", newKey.AccessKeyID)
+
+	rollback := func(cause error) error {
+		if err := client.DeleteAccessKey(newKey.AccessKeyID); err != nil {
+			return fmt.Errorf("%s, and deleting new access key %s failed: %s", cause, newKey.AccessKeyID, err)
+		}
+
+		return fmt.Errorf("%s, new access key %s was deleted", cause, newKey.AccessKeyID)
+	}
+
+	if err := verifyAccessKey(newKey, input.Endpoints); err != nil {
+		return rollback(err)
+	}
+
+	rotated := *account
+	rotated.AWSAccessKeyId = newKey.AccessKeyID
+	rotated.AWSSecretAccessKey = newKey.SecretAccessKey
+	if err := replaceConfigKey(input.ConfigPath, account, &rotated); err != nil {
+		return rollback(err)
+	}
+	fmt.Fprintf(input.Out, "Updated %s\n", input.ConfigPath)
+
+	// Without MFA the new key cleans up the old one. With MFA the existing
+	// session is kept so the user is not prompted for a second token.
+	if account.DefaultMFADevice() == "" {
+		client = newIAMClient(credentials.NewStaticCredentials(newKey.AccessKeyID, newKey.SecretAccessKey, ""), httpClient, input.Endpoints)
+	}
+
+	if err := client.UpdateAccessKey(account.AWSAccessKeyId, "Inactive"); err != nil {
+		return fmt.Errorf("configuration uses the new key but deactivating %s failed: %s", account.AWSAccessKeyId, err)
+	}
+	fmt.Fprintf(input.Out, "Deactivated access key %s\n", account.AWSAccessKeyId)
+
+	if err := client.DeleteAccessKey(account.AWSAccessKeyId); err != nil {
+		return fmt.Errorf("access key %s is inactive but deleting it failed: %s", account.AWSAccessKeyId, err)
+	}
+	fmt.Fprintf(input.Out, "Deleted access key %s\n", account.AWSAccessKeyId)
+
+	// The stored MFA session belongs to the old key
+	removeSessions(input.StateDir, account.AWSAccessKeyId)
+
+	return nil
+}
+
+type keyStatusInput struct {
+	Accounts  []Account `required:"true"`
+	StateDir  string    `required:"true"`
+	MFAToken  func(account *Account) mfaToken
+	Lock      lockOptions
+	Endpoints EndpointConfig
+	MaxAge    time.Duration
+	Out       io.Writer
+	WarnOut   io.Writer
+}
+
+// Print the age and last use of each account's access key, warning about
+// keys older than the maximum age
+func accessKeyStatus(input keyStatusInput) error {
+	w := tabwriter.NewWriter(input.Out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tACCESS KEY\tSTATUS\tAGE (DAYS)\tLAST USED\tSERVICE")
+
+	var warnings []string
+	for i := range input.Accounts {
+		account := &input.Accounts[i]
+		if !account.hasStaticKeys() {
+			continue
+		}
+
+		endpoints := input.Endpoints.merge(account.Endpoints)
+		httpClient, err := endpoints.httpClient()
+		if err != nil {
+			return err
+		}
+
+		creds, err := keyManagementCredentials(account, input.StateDir, input.MFAToken(account), input.Lock, &endpoints)
+		if err != nil {
+			return err
+		}
+		client := newIAMClient(creds, httpClient, &endpoints)
+
+		keys, err := client.ListAccessKeys()
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, key := range keys {
+			if key.AccessKeyID != account.AWSAccessKeyId {
+				continue
+			}
+			found = true
+
+			lastUsed, err := client.GetAccessKeyLastUsed(key.AccessKeyID)
+			if err != nil {
+				return err
+			}
+
+			used, service := "never", "-"
+			if !lastUsed.LastUsedDate.IsZero() {
+				used = lastUsed.LastUsedDate.Format("2006-01-02")
+				service = lastUsed.ServiceName
+			}
+
+			age := time.Since(key.CreateDate)
+			fmt.Fprintf(
+				w,
+				"%s\t%s\t%s\t%d\t%s\t%s\n",
+				account.DisplayName(),
+				key.AccessKeyID,
+				key.Status,
+				int(age.Hours()/24),
+				used,
+				service,
+			)
+
+			if input.MaxAge > 0 && age > input.MaxAge {
+				warnings = append(warnings, fmt.Sprintf(
+					"WARNING: access key %s of %s is %d days old, rotate it with aws-session keys rotate",
+					key.AccessKeyID,
+					account.DisplayName(),
+					int(age.Hours()/24),
+				))
+			}
+		}
+
+		if !found {
+			fmt.Fprintf(w, "%s\t%s\tMissing\t-\t-\t-\n", account.DisplayName(), account.AWSAccessKeyId)
+			warnings = append(warnings, fmt.Sprintf(
+				"WARNING: access key %s of %s is not listed for the user, it may have been deleted",
+				account.AWSAccessKeyId,
+				account.DisplayName(),
+			))
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	for _, warning := range warnings {
+		fmt.Fprintln(input.WarnOut, warning)
+	}
+
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestReplaceConfigKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	original := `---
+# base account
+accounts:
+- name: main
+  aws_access_key_id: 'AKIAOLD'
+  aws_secret_access_key: 'oldsecret'
+`
+	if err := ioutil.WriteFile(path, []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	old := &Account{AWSAccessKeyId: "AKIAOLD", AWSSecretAccessKey: "oldsecret"}
+	rotated := &Account{AWSAccessKeyId: "AKIANEW", AWSSecretAccessKey: "newsecret"}
+	if err := replaceConfigKey(path, old, rotated); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `---
+# base account
+accounts:
+- name: main
+  aws_access_key_id: 'AKIANEW'
+  aws_secret_access_key: 'newsecret'
+`
+	if string(b) != expected {
+		t.Errorf("expected %q but got %q", expected, string(b))
+	}
+
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600 but got %s", info.Mode())
+	}
+
+	if err := replaceConfigKey(path, old, rotated); err == nil {
+		t.Error("expected error for a key missing from the config")
+	}
+}
+
+func TestIAMListAccessKeys(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("Action") != "ListAccessKeys" || r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Write([]byte(`<ListAccessKeysResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">
+  <ListAccessKeysResult>
+    <AccessKeyMetadata>
+      <member>
+        <UserName>jim</UserName>
+        <AccessKeyId>AKIAEXAMPLE</AccessKeyId>
+        <Status>Active</Status>
+        <CreateDate>2016-12-01T22:19:58Z</CreateDate>
+      </member>
+    </AccessKeyMetadata>
+  </ListAccessKeysResult>
+</ListAccessKeysResponse>`))
+	}))
+	defer server.Close()
+
+	client := newIAMClient(credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""), http.DefaultClient, &EndpointConfig{IAMEndpoint: server.URL})
+
+	keys, err := client.ListAccessKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 1 || keys[0].AccessKeyID != "AKIAEXAMPLE" || keys[0].CreateDate.Year() != 2016 {
+		t.Errorf("unexpected keys %+v", keys)
+	}
+}
+
+func TestAccessKeyStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if !strings.Contains(r.Header.Get("Authorization"), "/us-gov-west-1/iam/") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch r.Form.Get("Action") {
+		case "ListAccessKeys":
+			w.Write([]byte(`<ListAccessKeysResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">
+  <ListAccessKeysResult>
+    <AccessKeyMetadata>
+      <member>
+        <AccessKeyId>AKIAEXAMPLE</AccessKeyId>
+        <Status>Active</Status>
+        <CreateDate>2016-12-01T22:19:58Z</CreateDate>
+      </member>
+    </AccessKeyMetadata>
+  </ListAccessKeysResult>
+</ListAccessKeysResponse>`))
+		case "GetAccessKeyLastUsed":
+			w.Write([]byte(`<GetAccessKeyLastUsedResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">
+  <GetAccessKeyLastUsedResult>
+    <AccessKeyLastUsed>
+      <ServiceName>N/A</ServiceName>
+      <Region>N/A</Region>
+    </AccessKeyLastUsed>
+  </GetAccessKeyLastUsedResult>
+</GetAccessKeyLastUsedResponse>`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	var out, warnings bytes.Buffer
+	err := accessKeyStatus(keyStatusInput{
+		Accounts: []Account{
+			{Name: "listed", AWSAccessKeyId: "AKIAEXAMPLE", AWSSecretAccessKey: "secret"},
+			{Name: "deleted", AWSAccessKeyId: "AKIADELETED", AWSSecretAccessKey: "secret"},
+		},
+		StateDir:  "unused",
+		MFAToken:  func(account *Account) mfaToken { return mfaToken{} },
+		Endpoints: EndpointConfig{STSRegion: "us-gov-west-1", IAMEndpoint: server.URL},
+		Out:       &out,
+		WarnOut:   &warnings,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "AKIAEXAMPLE  Active") || !strings.Contains(out.String(), "AKIADELETED  Missing") {
+		t.Errorf("expected the listed key and the missing one but got\n%s", out.String())
+	}
+
+	if !strings.Contains(warnings.String(), "access key AKIADELETED of deleted is not listed") {
+		t.Errorf("expected a warning about the missing key but got %q", warnings.String())
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// LocalStack accepts any credentials and documents these
+const defaultLocalCredential = "test"
+
+// Environment variable overriding the endpoint of one service, as read by
+// the AWS CLI and SDKs
+type serviceEndpoint struct {
+	Variable string
+	URL      string
+}
+
+// Report whether the alias points at a local emulator instead of AWS
+func (a *Alias) isLocal() bool {
+	return a.EndpointURL != ""
+}
+
+// Check the settings of a local alias, which can not assume roles
+func (a *Alias) validateLocal() error {
+	if !a.isLocal() {
+		if len(a.ServiceEndpoints) > 0 {
+			return fmt.Errorf("service_endpoints requires endpoint_url")
+		}
+		return nil
+	}
+
+	if a.RoleARN() != "" || a.Federation || a.MFADevice != "" {
+		return fmt.Errorf("endpoint_url aliases can not set a role, federation_token or mfa_device")
+	}
+
+	urls := []string{a.EndpointURL}
+	for _, endpoint := range a.ServiceEndpoints {
+		urls = append(urls, endpoint)
+	}
+
+	for _, endpoint := range urls {
+		u, err := url.Parse(endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("endpoint %s must be an http or https URL", endpoint)
+		}
+	}
+
+	return nil
+}
+
+// Return the dummy credentials of a local alias
+func localCredentials(alias *Alias) *sessionCredentials {
+	creds := &sessionCredentials{
+		AccessKeyID:     alias.AWSAccessKeyId,
+		SecretAccessKey: alias.AWSSecretAccessKey,
+	}
+
+	if creds.AccessKeyID == "" {
+		creds.AccessKeyID = defaultLocalCredential
+	}
+	if creds.SecretAccessKey == "" {
+		creds.SecretAccessKey = defaultLocalCredential
+	}
+
+	return creds
+}
+
+// Return the variable name for a service, such as AWS_ENDPOINT_URL_S3 or
+// AWS_ENDPOINT_URL_DYNAMODB_STREAMS for "dynamodb streams"
+func serviceEndpointVariable(service string) string {
+	name := strings.ToUpper(strings.TrimSpace(service))
+	name = strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+
+	return "AWS_ENDPOINT_URL_" + name
+}
+
+// Return the endpoint variables for every service named in the config,
+// blank unless set in endpoints, so switching aliases unsets them
+func serviceEndpointVars(services []string, endpoints map[string]string) []serviceEndpoint {
+	vars := make([]serviceEndpoint, len(services))
+	for i, service := range services {
+		vars[i] = serviceEndpoint{
+			Variable: serviceEndpointVariable(service),
+			URL:      endpoints[service],
+		}
+	}
+
+	return vars
+}
+
+// Return the services with endpoints on any alias, sorted
+func (c *Config) ServiceEndpointNames() []string {
+	seen := make(map[string]bool)
+	var services []string
+
+	for _, account := range c.Accounts {
+		for _, alias := range account.Aliases {
+			for service := range alias.ServiceEndpoints {
+				if !seen[service] {
+					seen[service] = true
+					services = append(services, service)
+				}
+			}
+		}
+	}
+	sort.Strings(services)
+
+	return services
+}
+
+// Report whether every alias of the account is local, so it needs no
+// credentials of its own
+func (a *Account) localOnly() bool {
+	for _, alias := range a.Aliases {
+		if !alias.isLocal() {
+			return false
+		}
+	}
+
+	return len(a.Aliases) > 0
+}
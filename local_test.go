@@ -0,0 +1,143 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalAlias(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yaml")
+	config := `---
+accounts:
+- aliases:
+  - name: local
+    account_number: 1
+    endpoint_url: http://localhost:4566
+    service_endpoints:
+      s3: http://localhost:4572
+- aws_access_key_id: 'AKIAEXAMPLE'
+  aws_secret_access_key: 'secret'
+  aliases:
+  - name: dev-read
+    account_number: 123456789012
+    role: readonly
+    service_endpoints:
+      dynamodb streams: http://localhost:8000
+`
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "requires endpoint_url") {
+		t.Errorf("expected error for service_endpoints without endpoint_url but got %v", err)
+	}
+
+	config = strings.Replace(config, "    service_endpoints:\n      dynamodb streams: http://localhost:8000\n", "", 1)
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alias, _, err := loaded.GetAlias("local")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := envOut(localCredentials(alias), envOutInput{
+		AccountName:      alias.Name,
+		UserShell:        "bash",
+		EndpointURL:      alias.EndpointURL,
+		ServiceEndpoints: serviceEndpointVars(loaded.ServiceEndpointNames(), alias.ServiceEndpoints),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"export AWS_ACCESS_KEY_ID=test\n",
+		"export AWS_ENDPOINT_URL=http://localhost:4566\n",
+		"export AWS_ENDPOINT_URL_S3=http://localhost:4572\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected %q in\n%s", line, out)
+		}
+	}
+
+}
+
+func TestEnvOut_unsetsEndpoints(t *testing.T) {
+	creds := &sessionCredentials{
+		AccessKeyID:     "ASIAEXAMPLE",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+	}
+
+	// Real aliases unset the endpoints of local ones
+	tests := map[string]string{
+		"bash": "export AWS_ACCESS_KEY_ID=ASIAEXAMPLE\n" +
+			"export AWS_ACCOUNT_NAME=prod\n" +
+			"export AWS_ACCOUNT_NUMBER=123456789012\n" +
+			"export AWS_SECRET_ACCESS_KEY=secret\n" +
+			"export AWS_SESSION_EXPIRATION=\n" +
+			"export AWS_SESSION_TOKEN=token\n" +
+			"unset AWS_ENDPOINT_URL\n" +
+			"unset AWS_ENDPOINT_URL_S3\n",
+		"powershell": "$env:AWS_ACCESS_KEY_ID = 'ASIAEXAMPLE'\n" +
+			"$env:AWS_ACCOUNT_NAME = 'prod'\n" +
+			"$env:AWS_ACCOUNT_NUMBER = '123456789012'\n" +
+			"$env:AWS_SECRET_ACCESS_KEY = 'secret'\n" +
+			"$env:AWS_SESSION_EXPIRATION = ''\n" +
+			"$env:AWS_SESSION_TOKEN = 'token'\n" +
+			"Remove-Item Env:AWS_ENDPOINT_URL -ErrorAction SilentlyContinue\n" +
+			"Remove-Item Env:AWS_ENDPOINT_URL_S3 -ErrorAction SilentlyContinue\n",
+		"env": "AWS_ACCESS_KEY_ID=ASIAEXAMPLE\n" +
+			"AWS_ACCOUNT_NAME=prod\n" +
+			"AWS_ACCOUNT_NUMBER=123456789012\n" +
+			"AWS_SECRET_ACCESS_KEY=secret\n" +
+			"AWS_SESSION_EXPIRATION=\n" +
+			"AWS_SESSION_TOKEN=token\n",
+	}
+
+	for format, expected := range tests {
+		out, err := envOut(creds, envOutInput{
+			AccountName:      "prod",
+			AccountID:        "123456789012",
+			UserShell:        format,
+			ServiceEndpoints: serviceEndpointVars([]string{"s3"}, nil),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if out != expected {
+			t.Errorf("expected %s output\n%s\nbut got\n%s", format, expected, out)
+		}
+	}
+}
+
+func TestServiceEndpointVariable(t *testing.T) {
+	tests := map[string]string{
+		"s3":               "AWS_ENDPOINT_URL_S3",
+		"dynamodb streams": "AWS_ENDPOINT_URL_DYNAMODB_STREAMS",
+		"secrets-manager":  "AWS_ENDPOINT_URL_SECRETS_MANAGER",
+	}
+
+	for service, expected := range tests {
+		if variable := serviceEndpointVariable(service); variable != expected {
+			t.Errorf("expected %s for %s but got %s", expected, service, variable)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	locksDirName = "locks"
+
+	// Long enough for another process to wait on an MFA prompt
+	defaultLockTimeout    = 2 * time.Minute
+	defaultLockStaleAfter = 10 * time.Minute
+	lockPollInterval      = 100 * time.Millisecond
+)
+
+// Settings for waiting on locks held by other aws-session processes
+type lockOptions struct {
+	Timeout    time.Duration
+	StaleAfter time.Duration
+}
+
+// Details written to a lock file identifying the process holding it. The
+// token tells apart locks taken by the same process.
+type lockOwner struct {
+	PID      int       `json:"pid"`
+	Hostname string    `json:"hostname"`
+	Created  time.Time `json:"created"`
+	Token    string    `json:"token"`
+}
+
+// Advisory lock held through the existence of a file
+type fileLock struct {
+	path  string
+	owner []byte
+}
+
+// Return the lock file for a name under the state directory
+func lockPath(stateDir, name string) string {
+	return filepath.Join(stateDir, locksDirName, name+".lock")
+}
+
+// Acquire the lock at path, waiting for other processes to release it.
+// Locks left behind by processes that exited, or older than the stale
+// threshold, are removed.
+func acquireLock(path string, opts lockOptions) (*fileLock, error) {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = defaultLockTimeout
+	}
+
+	staleAfter := opts.StaleAfter
+	if staleAfter == 0 {
+		staleAfter = defaultLockStaleAfter
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+
+	hostname, _ := os.Hostname()
+	owner, err := json.Marshal(lockOwner{
+		PID:      os.Getpid(),
+		Hostname: hostname,
+		Created:  time.Now(),
+		Token:    hex.EncodeToString(token),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = f.Write(owner)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+
+			return &fileLock{path: path, owner: owner}, nil
+		} else if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if stale, ok := lockIsStale(path, hostname, staleAfter); ok {
+			removeLockFile(path, stale)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf(
+				"timed out after %s waiting for another aws-session process, remove %s if it is no longer running",
+				timeout,
+				path,
+			)
+		}
+
+		if !waiting {
+			fmt.Fprintln(os.Stderr, "Waiting for another aws-session process to refresh credentials...")
+			waiting = true
+		}
+
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// Report whether a lock file was left behind, returning the contents it
+// was judged on. Locks are stale once they pass the age threshold or, when
+// held on this host, once the owning process has exited.
+func lockIsStale(path, hostname string, staleAfter time.Duration) ([]byte, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	if time.Since(info.ModTime()) > staleAfter {
+		return b, true
+	}
+
+	// The owner may not have written its details yet
+	var owner lockOwner
+	if err := json.Unmarshal(b, &owner); err != nil {
+		return nil, false
+	}
+
+	if owner.Hostname != hostname {
+		return nil, false
+	}
+
+	return b, owner.PID <= 0 || !processAlive(owner.PID)
+}
+
+// Remove the lock file if it still holds the given contents. The file is
+// first moved to a name unique to this process, so of several processes
+// removing the same lock only one succeeds, and a lock that was replaced
+// in the meantime is moved back. Report whether the file was removed.
+func removeLockFile(path string, contents []byte) bool {
+	moved := fmt.Sprintf("%s.%d-%d", path, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(path, moved); err != nil {
+		return false
+	}
+
+	b, err := ioutil.ReadFile(moved)
+	if err == nil && bytes.Equal(b, contents) {
+		os.Remove(moved)
+		return true
+	}
+
+	// Linking fails if yet another lock was created, which then holds it
+	os.Link(moved, path)
+	os.Remove(moved)
+
+	return false
+}
+
+// Release the lock unless it was taken over as stale, in which case the
+// file belongs to its new owner and is left in place
+func (l *fileLock) Release() error {
+	if !removeLockFile(l.path, l.owner) {
+		return fmt.Errorf("lock %s is no longer held by this process", l.path)
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAcquireLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := lockPath(dir, "sandbox")
+	opts := lockOptions{Timeout: 300 * time.Millisecond}
+
+	lock, err := acquireLock(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := acquireLock(path, opts); err == nil {
+		t.Error("expected a held lock to time out")
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err = acquireLock(path, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Release()
+}
+
+func TestAcquireLock_stale(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := lockPath(dir, "sandbox")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	hostname, _ := os.Hostname()
+	b, _ := json.Marshal(lockOwner{PID: -1, Hostname: hostname, Created: time.Now()})
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := acquireLock(path, lockOptions{Timeout: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("expected lock of an exited process to be replaced: %s", err)
+	}
+	lock.Release()
+}
+
+func TestAcquireLock_staleRace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := lockPath(dir, "sandbox")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	hostname, _ := os.Hostname()
+	b, _ := json.Marshal(lockOwner{PID: -1, Hostname: hostname, Created: time.Now()})
+	if err := ioutil.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Waiters in this process see each other's locks as live, so only one
+	// of them can take over the stale lock
+	var held int32
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := acquireLock(path, lockOptions{Timeout: 300 * time.Millisecond}); err == nil {
+				atomic.AddInt32(&held, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if held != 1 {
+		t.Errorf("expected one waiter to hold the lock but %d did", held)
+	}
+}
+
+func TestReleaseLock_takenOver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := lockPath(dir, "sandbox")
+	lock, err := acquireLock(path, lockOptions{Timeout: 300 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process took the lock over after judging it stale
+	if err := ioutil.WriteFile(path, []byte(`{"pid":1,"token":"other"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lock.Release(); err == nil {
+		t.Error("expected error releasing a lock held by another process")
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil || string(b) != `{"pid":1,"token":"other"}` {
+		t.Errorf("expected the new owner's lock to remain but got %q, %v", b, err)
+	}
+
+	matches, _ := filepath.Glob(path + ".*")
+	if len(matches) != 0 {
+		t.Errorf("expected no leftover files but got %v", matches)
+	}
+}
@@ -5,49 +5,342 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	awscredentials "github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/urfave/cli"
 )
 
 var Version = ""
 
+// Return the MFA token read from the token-code flag or the configured
+// sources, so users are only prompted once STS actually needs a token
+func mfaTokenFunc(c *cli.Context, source mfaTokenSource) mfaToken {
+	source.TokenCode = c.String("token-code")
+	source.Askpass = os.Getenv(askpassEnv)
+	source.NoPrompt = c.Bool("no-prompt")
+
+	return mfaToken{Code: source.token, Fixed: source.TokenCode != ""}
+}
+
+// Return the lock settings from the config and lock-timeout flag
+func lockSettings(c *cli.Context, config *Config) lockOptions {
+	lockTimeout := config.Lock.Timeout
+	if c.IsSet("lock-timeout") {
+		lockTimeout = c.Int("lock-timeout")
+	}
+
+	return lockOptions{
+		Timeout:    time.Duration(lockTimeout) * time.Second,
+		StaleAfter: time.Duration(config.Lock.StaleAfter) * time.Second,
+	}
+}
+
+// Return the duration from the duration flag or the alias default
+func durationSetting(c *cli.Context, alias *Alias) (int, error) {
+	value := c.String("duration")
+	if value == "" {
+		value = alias.Duration
+	}
+
+	return aliasDuration(value, alias)
+}
+
+// Build the credential request for an alias using the command's flags
+func aliasInput(c *cli.Context, config *Config, aliasName string) (roleCredentialsInput, *Alias, error) {
+	if aliasName == "" {
+		return roleCredentialsInput{}, nil, fmt.Errorf("alias flag can not be empty")
+	}
+
+	alias, credentials, err := config.GetAlias(aliasName)
+	if err != nil {
+		return roleCredentialsInput{}, nil, err
+	}
+
+	accountNumber := ""
+	if alias.AccountNumber != 0 {
+		accountNumber = strconv.Itoa(alias.AccountNumber)
+	}
+
+	sessionName := c.String("session-name")
+	if sessionName == "" {
+		sessionName = alias.SessionName
+	}
+
+	sessionTemplate := alias.SessionNameTemplate
+	if sessionTemplate == "" {
+		sessionTemplate = config.SessionNameTemplate
+	}
+
+	duration, err := durationSetting(c, alias)
+	if err != nil {
+		return roleCredentialsInput{}, nil, err
+	}
+
+	// Web identity tokens, sso and roles anywhere replace the account's
+	// base credentials
+	webIdentity := aliasWebIdentityToken(alias, credentials)
+	var baseCreds *awscredentials.Credentials
+	if webIdentity == nil && credentials.SSO == nil && credentials.RolesAnywhere == nil {
+		baseCreds = baseCredentials(credentials)
+	}
+
+	deviceSelector := c.String("mfa-device")
+	if deviceSelector == "" {
+		deviceSelector = alias.MFADevice
+	}
+
+	device, err := credentials.MFADevice(deviceSelector)
+	if err != nil {
+		return roleCredentialsInput{}, nil, err
+	}
+
+	var deviceID, deviceName string
+	if device != nil {
+		deviceID, deviceName = device.ARN, device.Name
+	}
+
+	// The seed only generates codes for the default device
+	totp := credentials.MFATOTP
+	if defaultDevice, _ := credentials.MFADevice(""); defaultDevice == nil || defaultDevice.ARN != deviceID {
+		totp = nil
+	}
+
+	token := mfaTokenFunc(c, mfaTokenSource{
+		TOTP:       totp,
+		Command:    credentials.MFACommand,
+		Name:       alias.Name,
+		DeviceName: deviceName,
+		DeviceID:   deviceID,
+	})
+
+	input := roleCredentialsInput{
+		Credentials:       baseCreds,
+		AccountName:       alias.Name,
+		AWSAccountNumber:  accountNumber,
+		RoleArn:           alias.RoleARN(),
+		RoleName:          alias.Role,
+		Federation:        alias.Federation,
+		SAML:              credentials.Source == sourceSAML,
+		WebIdentityToken:  webIdentity,
+		SSO:               credentials.SSO,
+		RolesAnywhere:     credentials.RolesAnywhere,
+		MFADeviceID:       deviceID,
+		MFAToken:          token,
+		StateDir:          config.StateDir(),
+		SessionDuration:   credentials.SessionDuration,
+		SessionName:       sessionName,
+		SessionTemplate:   sessionTemplate,
+		Reason:            c.String("reason"),
+		Duration:          duration,
+		Policy:            alias.Policy,
+		SessionTags:       alias.SessionTags,
+		Cache:             newCacheMode(config.Cache.Disabled || c.Bool("no-cache"), c.Bool("refresh")),
+		CacheMinRemaining: time.Duration(config.Cache.MinRemaining) * time.Second,
+		Lock:              lockSettings(c, config),
+		Endpoints:         credentials.Endpoints,
+	}
+
+	return input, alias, nil
+}
+
 func webCommand(c *cli.Context) error {
 	config, err := LoadConfig(c.GlobalString("config"))
 	if err != nil {
 		return err
 	}
 
+	roleInput, alias, err := aliasInput(c, config, c.String("alias"))
+	if err != nil {
+		return err
+	}
+
+	if alias.isLocal() {
+		return fmt.Errorf("alias %s uses a local endpoint, which has no console", alias.Name)
+	}
+
+	out, err := webOut(webOutInput{roleInput})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(out)
+
+	return nil
+}
+
+func authCommand(c *cli.Context) error {
+	config, err := LoadConfig(c.GlobalString("config"))
+	if err != nil {
+		return err
+	}
+
+	exports, err := parseAliasExports(c.StringSlice("alias"))
+	if err != nil {
+		return err
+	}
+
+	// Aliases sharing a base account reuse the MFA session stored for the
+	// first one, so the token is only asked for once
+	var out string
+	for _, export := range exports {
+		aliasOut, err := aliasEnvOut(c, config, export)
+		if err != nil {
+			return err
+		}
+		out += aliasOut
+	}
+
+	fmt.Println(out)
+
+	return nil
+}
+
+// Return the environment variables for an alias exported by auth
+func aliasEnvOut(c *cli.Context, config *Config, export aliasExport) (string, error) {
+	creds, envInput, err := aliasCredentials(c, config, export.Name)
+	if err != nil {
+		return "", err
+	}
+	envInput.Namespace = export.namespace()
+
+	return envOut(creds, envInput)
+}
+
+// Return the credentials for an alias along with the settings exported
+// with them
+func aliasCredentials(c *cli.Context, config *Config, aliasName string) (*sessionCredentials, envOutInput, error) {
+	roleInput, alias, err := aliasInput(c, config, aliasName)
+	if err != nil {
+		return nil, envOutInput{}, err
+	}
+
+	region := c.String("region")
+	if alias.DefaultRegion != "" {
+		region = alias.DefaultRegion
+	}
+
+	// Every service endpoint is written or unset so switching aliases
+	// clears them
+	envInput := envOutInput{
+		AccountName:      alias.Name,
+		AccountID:        roleInput.AWSAccountNumber,
+		Region:           region,
+		UserShell:        c.String("format"),
+		EndpointURL:      alias.EndpointURL,
+		ServiceEndpoints: serviceEndpointVars(config.ServiceEndpointNames(), alias.ServiceEndpoints),
+	}
+
+	if alias.isLocal() {
+		return localCredentials(alias), envInput, nil
+	}
+
+	creds, err := cachedRoleCredentials(roleInput)
+	if err != nil {
+		return nil, envOutInput{}, err
+	}
+
+	return creds, envInput, nil
+}
+
+func samlCommand(c *cli.Context) error {
+	config, err := LoadConfig(c.GlobalString("config"))
+	if err != nil {
+		return err
+	}
+
+	assertion, err := readSAMLAssertion(c.String("assertion-file"))
+	if err != nil {
+		return err
+	}
+
+	roles, err := parseSAMLRoles(assertion)
+	if err != nil {
+		return err
+	}
+
 	aliasName := c.String("alias")
 	if aliasName == "" {
-		return fmt.Errorf("alias flag can not be empty")
+		for _, role := range roles {
+			names := samlAliasNames(config, role.RoleArn)
+			if len(names) == 0 {
+				names = []string{"-"}
+			}
+			fmt.Printf("%s\t%s\n", strings.Join(names, ","), role.RoleArn)
+		}
+
+		return nil
 	}
 
-	alias, credentials, err := config.GetAlias(aliasName)
+	// The alias settings give the same cache key auth and web look up
+	roleInput, alias, err := aliasInput(c, config, aliasName)
 	if err != nil {
 		return err
 	}
 
-	mfaTok := c.String("token-code")
-	if mfaTok == "" && credentials.MFARole != "" {
-		mfaTok, err = promptMFAToken()
-		if err != nil {
+	role, err := findSAMLRole(roles, roleInput.RoleArn)
+	if err != nil {
+		return err
+	}
+
+	duration := roleInput.Duration
+	if c.Bool("web") {
+		if err := checkConsoleDuration(duration); err != nil {
 			return err
 		}
 	}
 
-	input := webOutInput{
-		AWSAccessKeyID:     credentials.AWSAccessKeyId,
-		AWSSecretAccessKey: credentials.AWSSecretAccessKey,
-		AccountName:        alias.Name,
-		AWSAccountNumber:   strconv.Itoa(alias.AccountNumber),
-		RoleName:           alias.Role,
-		MFADeviceID:        credentials.MFARole,
-		TokenCode:          mfaTok,
-		SessionName:        c.String("session-name"),
-		Duration:           c.Int("duration"),
+	var result *sts.AssumeRoleWithSAMLOutput
+	err = withDurationFallback(duration, func(duration int) error {
+		result, err = assumeRoleWithSAML(assumeRoleWithSAMLInput{
+			Assertion: assertion,
+			Role:      role,
+			Duration:  duration,
+			Policy:    alias.Policy,
+			Endpoints: roleInput.Endpoints,
+		})
+		return err
+	})
+	if err != nil {
+		return err
 	}
+	creds := newSessionCredentials(result.Credentials)
 
-	out, err := webOut(input)
+	// Cached credentials let auth and web use the alias until they expire
+	if roleInput.Cache != cacheDisabled {
+		cache, err := openCredentialCache(roleInput.StateDir, roleInput.CacheMinRemaining)
+		if err != nil {
+			return err
+		}
+
+		if err := cache.Put(roleInput.cacheKey(), creds); err != nil {
+			return err
+		}
+	}
+
+	var out string
+	if c.Bool("web") {
+		var console int
+		console, err = consoleDuration(duration, creds.Expiration)
+		if err == nil {
+			out, err = signinURL(creds, console, roleInput.Endpoints)
+		}
+	} else {
+		region := c.String("region")
+		if alias.DefaultRegion != "" {
+			region = alias.DefaultRegion
+		}
+
+		out, err = envOut(creds, envOutInput{
+			AccountName:      alias.Name,
+			AccountID:        strconv.Itoa(alias.AccountNumber),
+			Region:           region,
+			UserShell:        c.String("format"),
+			ServiceEndpoints: serviceEndpointVars(config.ServiceEndpointNames(), nil),
+		})
+	}
 	if err != nil {
 		return err
 	}
@@ -57,57 +350,200 @@ func webCommand(c *cli.Context) error {
 	return nil
 }
 
-func authCommand(c *cli.Context) error {
+func keysRotateCommand(c *cli.Context) error {
 	config, err := LoadConfig(c.GlobalString("config"))
 	if err != nil {
 		return err
 	}
 
-	aliasName := c.String("alias")
-	if aliasName == "" {
-		return fmt.Errorf("alias flag can not be empty")
+	accountName := c.String("account")
+	if accountName == "" {
+		return fmt.Errorf("account flag can not be empty")
 	}
 
-	alias, credentials, err := config.GetAlias(aliasName)
+	account, err := config.GetAccount(accountName)
+	if err != nil {
+		return err
+	}
+
+	token := mfaTokenFunc(c, mfaTokenSource{
+		TOTP:     account.MFATOTP,
+		Command:  config.AccountMFACommand(account),
+		Name:     account.DisplayName(),
+		DeviceID: account.DefaultMFADevice(),
+	})
+
+	return rotateAccessKey(rotateKeyInput{
+		Account:    account,
+		ConfigPath: c.GlobalString("config"),
+		StateDir:   config.StateDir(),
+		MFAToken:   token,
+		Lock:       lockSettings(c, config),
+		Endpoints:  config.AccountEndpoints(account),
+		Out:        os.Stdout,
+	})
+}
+
+func keysStatusCommand(c *cli.Context) error {
+	config, err := LoadConfig(c.GlobalString("config"))
 	if err != nil {
 		return err
 	}
 
-	mfaTok := c.String("token-code")
-	if mfaTok == "" && credentials.MFARole != "" {
-		mfaTok, err = promptMFAToken()
+	accounts := config.Accounts
+	if accountName := c.String("account"); accountName != "" {
+		account, err := config.GetAccount(accountName)
 		if err != nil {
 			return err
 		}
+		accounts = []Account{*account}
 	}
 
-	region := c.String("region")
-	if alias.DefaultRegion != "" {
-		region = alias.DefaultRegion
+	maxAge := config.Keys.MaxAgeDays
+	if c.IsSet("max-age") {
+		maxAge = c.Int("max-age")
+	} else if maxAge == 0 {
+		maxAge = defaultKeyMaxAgeDays
+	}
+
+	// Accounts may generate their tokens from different seeds
+	token := func(account *Account) mfaToken {
+		return mfaTokenFunc(c, mfaTokenSource{
+			TOTP:     account.MFATOTP,
+			Command:  config.AccountMFACommand(account),
+			Name:     account.DisplayName(),
+			DeviceID: account.DefaultMFADevice(),
+		})
 	}
 
-	input := credentialsOutInput{
-		AWSAccessKeyID:     credentials.AWSAccessKeyId,
-		AWSSecretAccessKey: credentials.AWSSecretAccessKey,
-		AccountName:        alias.Name,
-		AWSAccountNumber:   strconv.Itoa(alias.AccountNumber),
-		RoleName:           alias.Role,
-		MFADeviceID:        credentials.MFARole,
-		TokenCode:          mfaTok,
-		SessionName:        c.String("session-name"),
-		Duration:           c.Int("duration"),
-		Region:             region,
-		UserShell:          c.String("format"),
+	return accessKeyStatus(keyStatusInput{
+		Accounts:  accounts,
+		StateDir:  config.StateDir(),
+		MFAToken:  token,
+		Lock:      lockSettings(c, config),
+		Endpoints: config.Endpoints,
+		MaxAge:    time.Duration(maxAge) * 24 * time.Hour,
+		Out:       os.Stdout,
+		WarnOut:   os.Stderr,
+	})
+}
+
+// Return an alias's credentials as KEY=value environment variables
+func aliasEnvironment(c *cli.Context, config *Config, aliasName string) ([]string, error) {
+	creds, envInput, err := aliasCredentials(c, config, aliasName)
+	if err != nil {
+		return nil, err
 	}
+	envInput.UserShell = "env"
 
-	out, err := credentialOut(input)
+	out, err := envOut(creds, envInput)
 	if err != nil {
+		return nil, err
+	}
+	vars := strings.Split(strings.TrimSpace(out), "\n")
+
+	// Blank endpoints remove those inherited from a local alias
+	for _, endpoint := range envInput.endpoints() {
+		if endpoint.URL == "" {
+			vars = append(vars, endpoint.Variable+"=")
+		}
+	}
+
+	return vars, nil
+}
+
+func execCommand(c *cli.Context) error {
+	if err := checkNesting(c.Bool("force")); err != nil {
 		return err
 	}
 
-	fmt.Println(out)
+	args := c.Args()
+	if len(args) > 1 && args[1] == "--" {
+		args = append(args[:1:1], args[2:]...)
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("an alias and a command are required, as in exec prod -- terraform plan")
+	}
 
-	return nil
+	config, err := LoadConfig(c.GlobalString("config"))
+	if err != nil {
+		return err
+	}
+
+	vars, err := aliasEnvironment(c, config, args[0])
+	if err != nil {
+		return err
+	}
+
+	return runWithCredentials(args[1:], commandEnv(os.Environ(), vars))
+}
+
+func shellSessionCommand(c *cli.Context) error {
+	if err := checkNesting(c.Bool("force")); err != nil {
+		return err
+	}
+
+	aliasName := c.Args().First()
+	if aliasName == "" {
+		return fmt.Errorf("an alias is required, as in shell prod")
+	}
+
+	config, err := LoadConfig(c.GlobalString("config"))
+	if err != nil {
+		return err
+	}
+
+	vars, err := aliasEnvironment(c, config, aliasName)
+	if err != nil {
+		return err
+	}
+
+	command, env, cleanup, err := shellInvocation(userShell(), aliasName, commandEnv(os.Environ(), vars))
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return runWithCredentials(command, env)
+}
+
+func foreachCommand(c *cli.Context) error {
+	config, err := LoadConfig(c.GlobalString("config"))
+	if err != nil {
+		return err
+	}
+
+	aliases, err := matchAliases(config, c.StringSlice("aliases"))
+	if err != nil {
+		return err
+	}
+
+	if c.NArg() == 0 {
+		return fmt.Errorf("a command to run is required, as in foreach --aliases 'prod-*' -- aws s3 ls")
+	}
+
+	environment := func(alias string) ([]string, error) {
+		return aliasEnvironment(c, config, alias)
+	}
+
+	return runForeach(foreachInput{
+		Aliases:     aliases,
+		Command:     c.Args(),
+		Environment: environment,
+		Concurrency: c.Int("concurrency"),
+		FailFast:    c.Bool("fail-fast"),
+		Collect:     c.Bool("collect"),
+		JSON:        c.Bool("json"),
+		Out:         os.Stdout,
+		ErrOut:      os.Stderr,
+	})
+}
+
+func doctorCommand(c *cli.Context) error {
+	return runDoctor(doctorInput{
+		ConfigPath: c.GlobalString("config"),
+		Out:        os.Stdout,
+	})
 }
 
 func listCommand(c *cli.Context) error {
@@ -123,6 +559,82 @@ func listCommand(c *cli.Context) error {
 	return nil
 }
 
+// Flags choosing where MFA token codes come from
+func mfaTokenFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name:   "token-code, T",
+			Value:  "",
+			Usage:  "MFA Token, - to read it from stdin",
+			EnvVar: "TOK_TOKEN",
+		},
+		cli.BoolFlag{
+			Name:  "no-prompt",
+			Usage: "Fail instead of prompting when an MFA token is needed",
+		},
+	}
+}
+
+// Region exported along with the credentials of an alias
+var regionFlag = cli.StringFlag{
+	Name:   "region, r",
+	Value:  "",
+	Usage:  "AWS Region for aliases without a default_region",
+	EnvVar: "TOK_REGION",
+}
+
+// Return the flags of every command resolving aliases to credentials, read
+// by aliasInput
+func aliasSessionFlags() []cli.Flag {
+	return append(mfaTokenFlags(),
+		cli.StringFlag{
+			Name:  "mfa-device",
+			Usage: "Name or ARN of the MFA device to use from the account's mfa_devices",
+		},
+		cli.StringFlag{
+			Name:  "session-name, n",
+			Value: "",
+			Usage: "Optional session name, will be generated if not set",
+		},
+		cli.StringFlag{
+			Name:  "reason",
+			Value: "",
+			Usage: "Reason for the session, available to session_name_template as {{.Reason}}",
+		},
+		cli.StringFlag{
+			Name:  "duration, d",
+			Value: "",
+			Usage: "Credential duration in seconds or as 8h, 90m or max, defaults to the alias duration or 1h",
+		},
+		cli.BoolFlag{
+			Name:  "no-cache",
+			Usage: "Do not read or store cached credentials",
+		},
+		cli.BoolFlag{
+			Name:  "refresh",
+			Usage: "Replace cached credentials with new ones",
+		},
+		cli.IntFlag{
+			Name:  "lock-timeout",
+			Usage: "Seconds to wait for another process refreshing the same credentials, default 120",
+		},
+	)
+}
+
+// Return the flags of exec and shell
+func commandSessionFlags() []cli.Flag {
+	return append(
+		[]cli.Flag{
+			cli.BoolFlag{
+				Name:  "force",
+				Usage: "Run even when credentials from aws-session are already set",
+			},
+			regionFlag,
+		},
+		aliasSessionFlags()...,
+	)
+}
+
 func main() {
 	app := cli.NewApp()
 	app.Name = "aws-session"
@@ -145,76 +657,172 @@ func main() {
 		{
 			Name:  "auth",
 			Usage: "Get credentials",
-			Flags: []cli.Flag{
-				cli.StringFlag{
+			Description: "Several aliases share one MFA prompt per base account. Accounts with\n" +
+				"   temporary base credentials ask for a new token code for each alias.",
+			Flags: append([]cli.Flag{
+				cli.StringSliceFlag{
 					Name:   "alias, A",
-					Value:  "",
-					Usage:  "Account Alias to fetch credentials for",
+					Usage:  "Account Alias to fetch credentials for, repeat as prefix=alias to export several",
 					EnvVar: "TOK_ALIAS",
 				},
 				cli.StringFlag{
 					Name:  "format, F",
 					Value: "",
-					Usage: "Format to expose secrets in Must be one of powershell, cmd, docker, bash.",
-				},
-				cli.StringFlag{
-					Name:   "token-code, T",
-					Value:  "",
-					Usage:  "MFA Token",
-					EnvVar: "TOK_TOKEN",
-				},
-				cli.StringFlag{
-					Name:   "region, r",
-					Value:  "",
-					Usage:  "AWS Region to include in ENV Variables.",
-					EnvVar: "TOK_REGION",
-				},
-				cli.StringFlag{
-					Name:  "session-name n",
-					Value: "",
-					Usage: "Optional session name, will be generated if not set",
+					Usage: "Format to expose secrets in Must be one of powershell, cmd, docker, env, bash.",
 				},
-				cli.IntFlag{
-					Name:  "duration, d",
-					Value: 3600,
-					Usage: "Credential duration, default 3600",
-				},
-			},
+				regionFlag,
+			}, aliasSessionFlags()...),
 			Action: authCommand,
 		},
 		{
 			Name:  "web",
 			Usage: "Generate Console Signin URL",
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				cli.StringFlag{
 					Name:   "alias, A",
 					Value:  "",
 					Usage:  "Account Alias to fetch credentials for",
 					EnvVar: "TOK_ALIAS",
 				},
+			}, aliasSessionFlags()...),
+			Action: webCommand,
+		},
+		{
+			Name:  "saml",
+			Usage: "Assume a role with a SAML assertion, lists granted roles without an alias",
+			Flags: []cli.Flag{
 				cli.StringFlag{
-					Name:   "token-code, T",
+					Name:   "alias, A",
 					Value:  "",
-					Usage:  "MFA Token",
-					EnvVar: "TOK_TOKEN",
+					Usage:  "Account Alias to fetch credentials for",
+					EnvVar: "TOK_ALIAS",
 				},
 				cli.StringFlag{
-					Name:  "session-name n",
+					Name:  "assertion-file, f",
 					Value: "",
-					Usage: "Optional session name, will be generated if not set",
+					Usage: "File containing the base64 SAMLResponse, - for stdin. Prompts for a paste if not set",
 				},
-				cli.IntFlag{
+				cli.BoolFlag{
+					Name:  "web",
+					Usage: "Generate a Console Signin URL instead of credentials",
+				},
+				cli.StringFlag{
+					Name:  "format, F",
+					Value: "",
+					Usage: "Format to expose secrets in Must be one of powershell, cmd, docker, env, bash.",
+				},
+				regionFlag,
+				cli.StringFlag{
 					Name:  "duration, d",
-					Value: 3600,
-					Usage: "Credential duration, default 3600",
+					Value: "",
+					Usage: "Credential duration in seconds or as 8h, 90m or max, defaults to the alias duration or 1h",
+				},
+				cli.BoolFlag{
+					Name:  "no-cache",
+					Usage: "Do not store the credentials for use by auth and web",
+				},
+			},
+			Action: samlCommand,
+		},
+		{
+			Name:  "keys",
+			Usage: "Manage the access keys of base accounts",
+			Subcommands: []cli.Command{
+				{
+					Name:  "rotate",
+					Usage: "Replace an account's access key and update the config",
+					Flags: append([]cli.Flag{
+						cli.StringFlag{
+							Name:  "account, a",
+							Value: "",
+							Usage: "Name of the account to rotate",
+						},
+					}, mfaTokenFlags()...),
+					Action: keysRotateCommand,
+				},
+				{
+					Name:  "status",
+					Usage: "Show access key age and last use",
+					Flags: append([]cli.Flag{
+						cli.StringFlag{
+							Name:  "account, a",
+							Value: "",
+							Usage: "Only show this account",
+						},
+						cli.IntFlag{
+							Name:  "max-age",
+							Usage: "Warn about keys older than this many days, default 90",
+						},
+					}, mfaTokenFlags()...),
+					Action: keysStatusCommand,
 				},
 			},
-			Action: webCommand,
+		},
+		{
+			Name:      "exec",
+			Usage:     "Run a command with an alias's credentials in its environment only",
+			ArgsUsage: "alias -- command [args...]",
+			Flags:     commandSessionFlags(),
+			Action:    execCommand,
+		},
+		{
+			Name:      "shell",
+			Usage:     "Start $SHELL with an alias's credentials and a marked prompt",
+			ArgsUsage: "alias",
+			Flags:     commandSessionFlags(),
+			Action:    shellSessionCommand,
+		},
+		{
+			Name:  "foreach",
+			Usage: "Run a command with the credentials of each matching alias",
+			Description: "Aliases share one MFA prompt per base account. Accounts with temporary\n" +
+				"   base credentials ask for a new token code for each alias.",
+			ArgsUsage: "-- command [args...]",
+			Flags: append([]cli.Flag{
+				cli.StringSliceFlag{
+					Name:  "aliases, a",
+					Usage: "Glob matching the aliases to run for, such as 'prod-*', can be repeated",
+				},
+				cli.IntFlag{
+					Name:  "concurrency, j",
+					Value: defaultForeachConcurrency,
+					Usage: "Number of aliases to run at once",
+				},
+				cli.BoolFlag{
+					Name:  "fail-fast",
+					Usage: "Stop the remaining aliases once one fails",
+				},
+				cli.BoolFlag{
+					Name:  "collect",
+					Usage: "Print each alias's output once its command finishes instead of prefixing lines",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "Print the results with each alias's output as JSON",
+				},
+				regionFlag,
+			}, aliasSessionFlags()...),
+			Action: foreachCommand,
+		},
+		{
+			Name:   "doctor",
+			Usage:  "Check the config, local state and clock for common problems",
+			Action: doctorCommand,
 		},
 	}
 
 	err := app.Run(os.Args)
 	if err != nil {
+		// Commands run by exec and shell report their own failures
+		if exitErr, ok := err.(*commandExitError); ok {
+			os.Exit(exitErr.code)
+		}
+
+		if d := diagnoseError(err); d != nil {
+			log.Printf("%s\n%s", err, d)
+			os.Exit(d.ExitCode)
+		}
+
 		log.Fatal(err)
 	}
 }
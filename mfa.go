@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	// Commands may wait for a touch on a hardware key
+	mfaCommandTimeout = 30 * time.Second
+
+	// Program asked for the token code instead of the terminal prompt
+	askpassEnv = "AWS_SESSION_ASKPASS"
+
+	// Token code value reading the code from stdin
+	tokenCodeStdin = "-"
+)
+
+var mfaCodePattern = regexp.MustCompile(`^\d{6}$`)
+
+// Returned when a token code is needed but prompting is disabled
+var errPromptDisabled = fmt.Errorf("an MFA token code is required but prompting is disabled by --no-prompt")
+
+// Where token codes come from when STS needs one, tried in field order
+type mfaTokenSource struct {
+	TokenCode string
+	TOTP      *TOTPConfig
+	Command   string
+	Askpass   string
+	NoPrompt  bool
+
+	// Named in prompts so users know which device to use
+	Name       string
+	DeviceName string
+	DeviceID   string
+}
+
+// Returns token codes for a device when STS needs one. Fixed codes, from
+// the token-code flag or stdin, are the same each time they are asked for.
+type mfaToken struct {
+	Code  func() (string, error)
+	Fixed bool
+}
+
+// Concurrent aliases of foreach take turns asking for token codes
+var tokenLock sync.Mutex
+
+// Stdin is read once, later requests from any alias reuse the code
+var stdinTokenCode string
+
+// Return the token code from the first source that is set
+func (s *mfaTokenSource) token() (string, error) {
+	tokenLock.Lock()
+	defer tokenLock.Unlock()
+
+	switch {
+	case s.TokenCode == tokenCodeStdin:
+		if stdinTokenCode == "" {
+			code, err := readTokenCode(os.Stdin)
+			if err != nil {
+				return "", err
+			}
+			stdinTokenCode = code
+		}
+
+		return stdinTokenCode, nil
+	case s.TokenCode != "":
+		return s.TokenCode, nil
+	case s.TOTP.enabled():
+		return s.TOTP.token()
+	case s.Command != "":
+		code, err := mfaCommandToken(s.Command)
+		if err == nil {
+			return code, nil
+		}
+
+		if s.Askpass == "" && s.NoPrompt {
+			fmt.Fprintln(os.Stderr, err)
+			return "", errPromptDisabled
+		}
+		fmt.Fprintf(os.Stderr, "%s, enter the code instead\n", err)
+	}
+
+	return s.prompt()
+}
+
+// Ask the askpass program or the terminal for the token code
+func (s *mfaTokenSource) prompt() (string, error) {
+	prompt := fmt.Sprintf("MFA token for %s", s.Name)
+	if s.DeviceName != "" {
+		prompt = fmt.Sprintf("%s from %s", prompt, s.DeviceName)
+	}
+	if s.DeviceID != "" {
+		prompt = fmt.Sprintf("%s (%s)", prompt, s.DeviceID)
+	}
+	prompt += ": "
+
+	if s.Askpass != "" {
+		return askpassToken(s.Askpass, prompt)
+	}
+
+	if s.NoPrompt {
+		return "", errPromptDisabled
+	}
+
+	return promptMFAToken(prompt)
+}
+
+// Read a token code from the first line of a reader
+func readTokenCode(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	code := strings.TrimSpace(line)
+	if code == "" {
+		if err != nil {
+			return "", fmt.Errorf("reading the MFA token code from stdin: %s", err)
+		}
+		return "", fmt.Errorf("no MFA token code on stdin")
+	}
+
+	return code, nil
+}
+
+// Run the askpass program with the prompt as its argument, as ssh does
+// with SSH_ASKPASS, and return what it prints
+func askpassToken(program, prompt string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mfaCommandTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, program, prompt)
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s failed: %s", askpassEnv, err)
+	}
+
+	code := strings.TrimSpace(out.String())
+	if code == "" {
+		return "", fmt.Errorf("%s printed no token code", askpassEnv)
+	}
+
+	return code, nil
+}
+
+// Run the mfa_command and return the token code it prints
+func mfaCommandToken(line string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mfaCommandTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := shellCommand(ctx, line)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("mfa_command timed out after %s", mfaCommandTimeout)
+		}
+		return "", fmt.Errorf("mfa_command failed: %s", err)
+	}
+
+	code := strings.TrimSpace(out.String())
+	if !mfaCodePattern.MatchString(code) {
+		return "", fmt.Errorf("mfa_command did not print a 6 digit code")
+	}
+
+	return code, nil
+}
+
+const (
+	mfaDirName = "mfa"
+
+	// AWS virtual and hardware MFA devices show a new code every 30 seconds
+	mfaStepPeriod = 30 * time.Second
+)
+
+// Time-step of the last token code STS accepted for a device. Only the step
+// is stored, never the code.
+type mfaStep struct {
+	Step int64 `json:"step"`
+}
+
+// Return the file storing the last used step of a device
+func mfaStepPath(stateDir, deviceID string) string {
+	sum := sha256.Sum256([]byte(deviceID))
+	return filepath.Join(stateDir, mfaDirName, hex.EncodeToString(sum[:]))
+}
+
+func currentMFAStep(now time.Time) int64 {
+	return now.Unix() / int64(mfaStepPeriod/time.Second)
+}
+
+// Return the last used step of a device, -1 when unknown. Tracking is best
+// effort so errors are treated as unknown.
+func lastMFAStep(stateDir, deviceID string) int64 {
+	key, err := loadStateKey(stateDir)
+	if err != nil {
+		return -1
+	}
+
+	var step mfaStep
+	if found, err := readSealed(mfaStepPath(stateDir, deviceID), key, &step); err != nil || !found {
+		return -1
+	}
+
+	return step.Step
+}
+
+func recordMFAStep(stateDir, deviceID string, step int64) {
+	key, err := loadStateKey(stateDir)
+	if err != nil {
+		return
+	}
+
+	writeSealed(mfaStepPath(stateDir, deviceID), key, &mfaStep{Step: step})
+}
+
+// Wait for the time-step after the given one, showing a countdown
+func waitForNextMFAStep(step int64) {
+	next := time.Unix((step+1)*int64(mfaStepPeriod/time.Second), 0)
+	countdown := terminal.IsTerminal(int(os.Stderr.Fd()))
+
+	if !countdown {
+		fmt.Fprintf(os.Stderr, "Waiting %ds for the next MFA token code\n", int(time.Until(next).Seconds())+1)
+		time.Sleep(time.Until(next))
+		return
+	}
+
+	for remaining := time.Until(next); remaining > 0; remaining = time.Until(next) {
+		fmt.Fprintf(os.Stderr, "\rWaiting %2ds for the next MFA token code", int(remaining.Seconds())+1)
+		if remaining > time.Second {
+			remaining = time.Second
+		}
+		time.Sleep(remaining)
+	}
+	fmt.Fprintf(os.Stderr, "\r%s\r", strings.Repeat(" ", 45))
+}
+
+// Report whether STS rejected the token code, which it also does for codes
+// that were already used
+func mfaCodeRejected(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == "AccessDenied" && strings.Contains(aerr.Message(), "MultiFactorAuthentication failed")
+}
+
+// Run a call sending a token code for the device. When the device's code
+// for the current time-step was already used, waits for the next one before
+// asking for a code. A rejected code is assumed to be a reused one, and a
+// new code is asked for once after the next time-step starts. Fixed codes
+// can not be replaced so they are sent without waiting and not retried.
+func withMFAToken(stateDir, deviceID string, token mfaToken, call func(code string) error) error {
+	if step := currentMFAStep(time.Now()); !token.Fixed && lastMFAStep(stateDir, deviceID) == step {
+		fmt.Fprintln(os.Stderr, "The MFA token code for this time window was already used")
+		waitForNextMFAStep(step)
+	}
+
+	code, err := token.Code()
+	if err != nil {
+		return err
+	}
+	step := currentMFAStep(time.Now())
+
+	err = call(code)
+	if err == nil {
+		recordMFAStep(stateDir, deviceID, step)
+		return nil
+	}
+
+	if token.Fixed || !mfaCodeRejected(err) {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "The MFA token code was rejected, it may have been used already")
+	waitForNextMFAStep(step)
+
+	// The rejection is what the user needs to see, not why no new code came
+	retryCode, tokenErr := token.Code()
+	if tokenErr != nil {
+		fmt.Fprintln(os.Stderr, tokenErr)
+		return err
+	}
+
+	if retryCode == code {
+		return err
+	}
+	step = currentMFAStep(time.Now())
+
+	if err := call(retryCode); err != nil {
+		return err
+	}
+	recordMFAStep(stateDir, deviceID, step)
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+func TestMFACommandToken(t *testing.T) {
+	code, err := mfaCommandToken("echo ' 123456 '")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code != "123456" {
+		t.Errorf("expected 123456 but got %q", code)
+	}
+
+	for _, line := range []string{"echo 12345", "echo not-a-code", "exit 1"} {
+		if _, err := mfaCommandToken(line); err == nil {
+			t.Errorf("expected error for %s", line)
+		}
+	}
+}
+
+func TestMFATokenSource(t *testing.T) {
+	code, err := readTokenCode(strings.NewReader("654321\n"))
+	if err != nil || code != "654321" {
+		t.Errorf("expected 654321 from stdin but got %q, %v", code, err)
+	}
+
+	// Stdin is read once and the code reused by every alias
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(stdin *os.File) { os.Stdin = stdin }(os.Stdin)
+	defer func() { stdinTokenCode = "" }()
+	os.Stdin = r
+	w.WriteString("654321\n")
+	w.Close()
+
+	for _, name := range []string{"prod", "prod", "dev"} {
+		source := &mfaTokenSource{TokenCode: tokenCodeStdin, Name: name}
+		if code, err := source.token(); err != nil || code != "654321" {
+			t.Errorf("expected 654321 from stdin for %s but got %q, %v", name, code, err)
+		}
+	}
+
+	source := &mfaTokenSource{NoPrompt: true, Name: "prod"}
+	if _, err := source.token(); err != errPromptDisabled {
+		t.Errorf("expected the prompt disabled error but got %v", err)
+	}
+
+	if d := diagnoseError(&assumeRoleError{err: errPromptDisabled}); d == nil || d.ExitCode != exitPromptDisabled {
+		t.Errorf("expected exit code %d for a disabled prompt", exitPromptDisabled)
+	}
+
+	// echo prints the prompt it is given, showing what users are asked
+	source = &mfaTokenSource{Askpass: "echo", Name: "prod", DeviceID: "arn:aws:iam::123456789012:mfa/jim"}
+	prompt, err := source.token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if prompt != "MFA token for prod (arn:aws:iam::123456789012:mfa/jim):" {
+		t.Errorf("unexpected prompt %q", prompt)
+	}
+}
+
+func TestMFAStepTracking(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	device := "arn:aws:iam::123456789012:mfa/jim"
+	if step := lastMFAStep(dir, device); step != -1 {
+		t.Errorf("expected an unknown step but got %d", step)
+	}
+
+	failed := fmt.Errorf("connection reset")
+	err = withMFAToken(dir, device, mfaToken{Code: func() (string, error) { return "123456", nil }}, func(code string) error {
+		return failed
+	})
+	if err != failed || lastMFAStep(dir, device) != -1 {
+		t.Errorf("expected a failed call to be returned and not recorded but got %v", err)
+	}
+
+	var sent string
+	err = withMFAToken(dir, device, mfaToken{Code: func() (string, error) { return "123456", nil }}, func(code string) error {
+		sent = code
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent != "123456" || lastMFAStep(dir, device) == -1 {
+		t.Errorf("expected the code to be sent and its step recorded")
+	}
+
+	if lastMFAStep(dir, "arn:aws:iam::123456789012:mfa/other") != -1 {
+		t.Error("expected steps to be tracked per device")
+	}
+}
+
+func TestWithMFAToken_fixedCode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	device := "arn:aws:iam::123456789012:mfa/jim"
+	recordMFAStep(dir, device, currentMFAStep(time.Now()))
+
+	asked, calls := 0, 0
+	token := mfaToken{
+		Code: func() (string, error) {
+			asked++
+			return "123456", nil
+		},
+		Fixed: true,
+	}
+
+	rejected := awserr.New("AccessDenied", "MultiFactorAuthentication failed with invalid MFA one time pass code.", nil)
+	start := time.Now()
+	err = withMFAToken(dir, device, token, func(code string) error {
+		calls++
+		return rejected
+	})
+
+	if err != rejected {
+		t.Errorf("expected the rejection to be returned but got %v", err)
+	}
+
+	if asked != 1 || calls != 1 {
+		t.Errorf("expected a fixed code to be sent once but it was asked for %d and sent %d times", asked, calls)
+	}
+
+	if time.Since(start) > 5*time.Second {
+		t.Error("expected a fixed code to be sent without waiting for the next time-step")
+	}
+}
+
+func TestMFACodeRejected(t *testing.T) {
+	rejected := awserr.New("AccessDenied", "MultiFactorAuthentication failed with invalid MFA one time pass code.", nil)
+	if !mfaCodeRejected(rejected) {
+		t.Error("expected a rejected code")
+	}
+
+	denied := awserr.New("AccessDenied", "User is not authorized to perform: sts:AssumeRole", nil)
+	if mfaCodeRejected(denied) || mfaCodeRejected(fmt.Errorf("other")) {
+		t.Error("expected other errors not to be a rejected code")
+	}
+}
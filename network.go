@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+const (
+	// Limit for a call to AWS including its retries
+	requestTimeout = 60 * time.Second
+
+	// Throttled and failed requests are retried with jittered backoff
+	requestMaxRetries = 3
+	retryBaseDelay    = 500 * time.Millisecond
+
+	// Longest part of an error response included in error messages
+	maxErrorBodyLength = 200
+)
+
+var errInterrupted = fmt.Errorf("interrupted")
+
+// Return a context for a call to AWS that ends after the request timeout or
+// when the user presses Ctrl-C. SIGINT is only caught while the call runs
+// so it still stops the process at other times.
+func newRequestContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(interrupt)
+		cancel()
+	}
+}
+
+// Replace errors caused by the request context ending with a plain message
+func requestError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch ctx.Err() {
+	case context.Canceled:
+		return errInterrupted
+	case context.DeadlineExceeded:
+		return fmt.Errorf("request timed out after %s", requestTimeout)
+	}
+
+	return err
+}
+
+// Request option sending an STS call only once. Calls carrying an MFA code
+// are not retried since the code can only be used once.
+func withoutRetries(r *request.Request) {
+	r.Retryer = client.DefaultRetryer{NumMaxRetries: 0}
+}
+
+// Report whether a response status is worth retrying
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || (code >= 500 && code != http.StatusNotImplemented)
+}
+
+// Return the delay before a retry, doubling with each attempt and jittered
+// so concurrent processes do not retry together
+func retryDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << uint(attempt)
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+}
+
+type httpResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Return the start of the body for use in error messages
+func (r *httpResponse) bodySnippet() string {
+	body := strings.TrimSpace(string(r.Body))
+	if len(body) > maxErrorBodyLength {
+		body = body[:maxErrorBodyLength] + "..."
+	}
+
+	return body
+}
+
+// Send a request built by newRequest, which is called again for each
+// attempt so bodies and signatures are fresh. Network errors, throttling
+// and server errors are retried when retry is set.
+func sendHTTPRequest(httpClient *http.Client, retry bool, newRequest func() (*http.Request, error)) (*httpResponse, error) {
+	ctx, cancel := newRequestContext()
+	defer cancel()
+
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := send(httpClient, req.WithContext(ctx))
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		if !retry || attempt >= requestMaxRetries || ctx.Err() != nil {
+			if err != nil {
+				return nil, requestError(ctx, err)
+			}
+			return resp, nil
+		}
+
+		select {
+		case <-time.After(retryDelay(attempt)):
+		case <-ctx.Done():
+			return nil, requestError(ctx, ctx.Err())
+		}
+	}
+}
+
+func send(httpClient *http.Client, req *http.Request) (*httpResponse, error) {
+	// The URL is left out of errors since it can carry credentials
+	resp, err := httpClient.Do(req)
+	if uerr, ok := err.(*url.Error); ok {
+		return nil, fmt.Errorf("%s %s: %s", req.Method, req.URL.Host, uerr.Err)
+	} else if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	recordClockSkew(resp.Header, time.Now())
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading response from %s: %s", req.URL.Host, err)
+	}
+
+	return &httpResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+	}, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestSendHTTPRequestRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	newRequest := func() (*http.Request, error) {
+		return http.NewRequest("GET", server.URL, nil)
+	}
+
+	resp, err := sendHTTPRequest(http.DefaultClient, true, newRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusOK || string(resp.Body) != "ok" || calls != 2 {
+		t.Errorf("expected a retried request but got %d after %d calls", resp.StatusCode, calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	resp, err = sendHTTPRequest(http.DefaultClient, false, newRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.StatusCode != http.StatusServiceUnavailable || calls != 1 {
+		t.Errorf("expected a single request but got %d after %d calls", resp.StatusCode, calls)
+	}
+}
+
+func TestMFASessionNotRetried(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = getSessionToken(sessionTokenInput{
+		Credentials:    credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""),
+		AWSAccessKeyID: "AKIAEXAMPLE",
+		MFADeviceID:    "arn:aws:iam::123456789012:mfa/jim",
+		MFAToken:       mfaToken{Code: func() (string, error) { return "123456", nil }},
+		StateDir:       dir,
+		Endpoints:      &EndpointConfig{STSEndpoint: server.URL},
+	})
+	if err == nil {
+		t.Fatal("expected error from a failing endpoint")
+	}
+
+	if calls != 1 {
+		t.Errorf("expected the MFA call to be sent once but it was sent %d times", calls)
+	}
+}
+
+func TestSigninURLUnexpectedResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>proxy login</html>"))
+	}))
+	defer server.Close()
+
+	creds := &sessionCredentials{AccessKeyID: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token"}
+	_, err := signinURL(creds, 0, &EndpointConfig{FederationEndpoint: server.URL})
+	if err == nil || !strings.Contains(err.Error(), "text/html") {
+		t.Errorf("expected an unexpected response error but got %v", err)
+	}
+}
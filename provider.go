@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Sources an account can take its base credentials from instead of static keys
+const (
+	sourceDefaultChain  = "default-chain"
+	sourceEnv           = "env"
+	sourceIMDS          = "imds"
+	sourceProfilePrefix = "profile:"
+)
+
+// Check that an account sets exactly one of static keys or a source.
+// Accounts whose aliases all use web identity tokens need neither.
+func validateSource(account Account) error {
+	hasKeys := account.AWSAccessKeyId != "" || account.AWSSecretAccessKey != ""
+
+	if account.SSO != nil && account.RolesAnywhere != nil {
+		return fmt.Errorf("account can not set both sso and roles_anywhere")
+	}
+
+	if account.SSO != nil {
+		if hasKeys || account.Source != "" {
+			return fmt.Errorf("sso accounts can not set aws_access_key_id or source")
+		}
+
+		return Validate(*account.SSO)
+	}
+
+	if account.RolesAnywhere != nil {
+		if hasKeys || account.Source != "" {
+			return fmt.Errorf("roles_anywhere accounts can not set aws_access_key_id or source")
+		}
+
+		return Validate(*account.RolesAnywhere)
+	}
+
+	switch {
+	case account.Source == "" && !hasKeys && usesWebIdentity(account):
+	case account.Source == "" && !hasKeys:
+		return fmt.Errorf("account must set aws_access_key_id, source or web_identity_token_file")
+	case account.Source != "" && hasKeys:
+		return fmt.Errorf("account can not set both aws_access_key_id and source %s", account.Source)
+	case account.Source == "":
+		if account.AWSAccessKeyId == "" || account.AWSSecretAccessKey == "" {
+			return fmt.Errorf("account must set both aws_access_key_id and aws_secret_access_key")
+		}
+	case account.Source == sourceDefaultChain, account.Source == sourceEnv, account.Source == sourceIMDS:
+	case account.Source == sourceSAML:
+	case strings.HasPrefix(account.Source, sourceProfilePrefix):
+		if strings.TrimPrefix(account.Source, sourceProfilePrefix) == "" {
+			return fmt.Errorf("source %s is missing a profile name", account.Source)
+		}
+	default:
+		return fmt.Errorf(
+			"unknown source %s, must be one of %s, %s, %s, %s or %s<name>",
+			account.Source,
+			sourceDefaultChain,
+			sourceEnv,
+			sourceIMDS,
+			sourceSAML,
+			sourceProfilePrefix,
+		)
+	}
+
+	return nil
+}
+
+// Return the provider of an account's base credentials
+func baseCredentials(creds *SecurityCredentials) *credentials.Credentials {
+	switch {
+	case creds.Source == sourceDefaultChain:
+		return defaults.CredChain(defaults.Config(), defaults.Handlers())
+	case creds.Source == sourceEnv:
+		return credentials.NewEnvCredentials()
+	case creds.Source == sourceIMDS:
+		return ec2rolecreds.NewCredentials(session.New())
+	case creds.Source == sourceSAML:
+		// Credentials are only issued by the saml command and read from
+		// the cache until they expire
+		return credentials.NewCredentials(credentials.ErrorProvider{
+			Err:          fmt.Errorf("no cached credentials, run aws-session saml to authenticate"),
+			ProviderName: sourceSAML,
+		})
+	case strings.HasPrefix(creds.Source, sourceProfilePrefix):
+		return credentials.NewSharedCredentials(
+			"",
+			strings.TrimPrefix(creds.Source, sourceProfilePrefix),
+		)
+	}
+
+	return credentials.NewStaticCredentials(
+		creds.AWSAccessKeyId,
+		creds.AWSSecretAccessKey,
+		creds.AWSSessionToken,
+	)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateSource(t *testing.T) {
+	sso := &SSOConfig{StartURL: "https://example.awsapps.com/start", Region: "us-east-1"}
+	rolesAnywhere := &RolesAnywhereConfig{
+		Certificate:    "cert.pem",
+		PrivateKey:     "key.pem",
+		TrustAnchorArn: "arn:aws:rolesanywhere:us-east-1:123456789012:trust-anchor/a",
+		ProfileArn:     "arn:aws:rolesanywhere:us-east-1:123456789012:profile/p",
+	}
+	webIdentity := []Alias{{Name: "ci", WebIdentityTokenFile: "/var/run/token"}}
+
+	invalid := []struct {
+		name    string
+		account Account
+		err     string
+	}{
+		{"nothing", Account{}, "must set aws_access_key_id, source or web_identity_token_file"},
+		{"key without secret", Account{AWSAccessKeyId: "AKIAEXAMPLE"}, "must set both"},
+		{"secret without key", Account{AWSSecretAccessKey: "secret"}, "must set both"},
+		{"keys and source", Account{AWSAccessKeyId: "AKIAEXAMPLE", AWSSecretAccessKey: "secret", Source: sourceEnv}, "can not set both aws_access_key_id and source"},
+		{"unknown source", Account{Source: "vault"}, "unknown source vault"},
+		{"profile without name", Account{Source: sourceProfilePrefix}, "missing a profile name"},
+		{"sso and roles anywhere", Account{SSO: sso, RolesAnywhere: rolesAnywhere}, "both sso and roles_anywhere"},
+		{"sso and keys", Account{SSO: sso, AWSAccessKeyId: "AKIAEXAMPLE"}, "sso accounts can not set"},
+		{"sso and source", Account{SSO: sso, Source: sourceIMDS}, "sso accounts can not set"},
+		{"sso without region", Account{SSO: &SSOConfig{StartURL: sso.StartURL}}, "Region"},
+		{"roles anywhere and keys", Account{RolesAnywhere: rolesAnywhere, AWSSecretAccessKey: "secret"}, "roles_anywhere accounts can not set"},
+		{"roles anywhere and source", Account{RolesAnywhere: rolesAnywhere, Source: sourceDefaultChain}, "roles_anywhere accounts can not set"},
+	}
+
+	for _, test := range invalid {
+		err := validateSource(test.account)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected error containing %q but got %v", test.name, test.err, err)
+		}
+	}
+
+	valid := map[string]Account{
+		"keys":           {AWSAccessKeyId: "AKIAEXAMPLE", AWSSecretAccessKey: "secret"},
+		"default chain":  {Source: sourceDefaultChain},
+		"env":            {Source: sourceEnv},
+		"imds":           {Source: sourceIMDS},
+		"saml":           {Source: sourceSAML},
+		"profile":        {Source: sourceProfilePrefix + "work"},
+		"web identity":   {Aliases: webIdentity},
+		"sso":            {SSO: sso},
+		"roles anywhere": {RolesAnywhere: rolesAnywhere},
+	}
+
+	for name, account := range valid {
+		if err := validateSource(account); err != nil {
+			t.Errorf("%s: unexpected error %s", name, err)
+		}
+	}
+}
+
+func TestBaseCredentials(t *testing.T) {
+	tests := []struct {
+		creds    SecurityCredentials
+		provider string
+	}{
+		{SecurityCredentials{AWSAccessKeyId: "AKIAEXAMPLE", AWSSecretAccessKey: "secret"}, "*credentials.StaticProvider"},
+		{SecurityCredentials{Source: sourceDefaultChain}, "*credentials.ChainProvider"},
+		{SecurityCredentials{Source: sourceEnv}, "*credentials.EnvProvider"},
+		{SecurityCredentials{Source: sourceIMDS}, "*ec2rolecreds.EC2RoleProvider"},
+		{SecurityCredentials{Source: sourceSAML}, "credentials.ErrorProvider"},
+		{SecurityCredentials{Source: sourceProfilePrefix + "work"}, "*credentials.SharedCredentialsProvider"},
+	}
+
+	for _, test := range tests {
+		creds := baseCredentials(&test.creds)
+
+		// The provider is not exported, and retrieving credentials from
+		// most of them needs the environment or the network
+		provider := reflect.ValueOf(creds).Elem().FieldByName("provider").Elem().Type().String()
+		if provider != test.provider {
+			t.Errorf("expected %s for %+v but got %s", test.provider, test.creds, provider)
+		}
+	}
+
+	if _, err := baseCredentials(&SecurityCredentials{Source: sourceSAML}).Get(); err == nil || !strings.Contains(err.Error(), "aws-session saml") {
+		t.Errorf("expected saml accounts to point at the saml command but got %v", err)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	rolesAnywhereService = "rolesanywhere"
+	x509DateFormat       = "20060102T150405Z"
+)
+
+type RolesAnywhereConfig struct {
+	Certificate    string `yaml:"certificate" required:"true"`
+	PrivateKey     string `yaml:"private_key" required:"true"`
+	TrustAnchorArn string `yaml:"trust_anchor_arn" required:"true"`
+	ProfileArn     string `yaml:"profile_arn" required:"true"`
+	Region         string `yaml:"region"`
+	Endpoint       string `yaml:"endpoint"`
+}
+
+// Return the region of the trust anchor unless one is configured
+func (r *RolesAnywhereConfig) region() string {
+	if r.Region != "" {
+		return r.Region
+	}
+
+	parts := strings.SplitN(r.TrustAnchorArn, ":", 6)
+	if len(parts) == 6 {
+		return parts[3]
+	}
+
+	return ""
+}
+
+func (r *RolesAnywhereConfig) endpoint() string {
+	if r.Endpoint != "" {
+		return strings.TrimSuffix(r.Endpoint, "/")
+	}
+
+	return fmt.Sprintf("https://%s.%s.amazonaws.com", rolesAnywhereService, r.region())
+}
+
+// Load the certificate and the RSA or ECDSA private key it was issued for
+func loadX509Identity(certPath, keyPath string) (*x509.Certificate, crypto.Signer, error) {
+	certPEM, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, nil, fmt.Errorf("%s does not contain a PEM certificate", certPath)
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, _ = pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, fmt.Errorf("%s does not contain a PEM private key", keyPath)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, nil, fmt.Errorf("%s has unsupported key type %s", keyPath, block.Type)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return cert, key, nil
+	case *ecdsa.PrivateKey:
+		return cert, key, nil
+	}
+
+	return nil, nil, fmt.Errorf("%s must contain an RSA or ECDSA key", keyPath)
+}
+
+// Return the SigV4-X509 algorithm name for a key
+func x509SigningAlgorithm(key crypto.Signer) (string, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return "AWS4-X509-RSA-SHA256", nil
+	case *ecdsa.PrivateKey:
+		return "AWS4-X509-ECDSA-SHA256", nil
+	}
+
+	return "", fmt.Errorf("unsupported key type %T", key)
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sign a request with the certificate using the SigV4-X509 algorithm. The
+// certificate serial number takes the place of the access key and the
+// string to sign is signed with the private key instead of an HMAC.
+func signX509Request(req *http.Request, body []byte, region string, cert *x509.Certificate, key crypto.Signer, now time.Time) error {
+	algorithm, err := x509SigningAlgorithm(key)
+	if err != nil {
+		return err
+	}
+
+	amzDate := now.UTC().Format(x509DateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-X509", base64.StdEncoding.EncodeToString(cert.Raw))
+
+	signedHeaders := "content-type;host;x-amz-date;x-amz-x509"
+	canonicalHeaders := fmt.Sprintf(
+		"content-type:%s\nhost:%s\nx-amz-date:%s\nx-amz-x509:%s\n",
+		req.Header.Get("Content-Type"),
+		req.URL.Host,
+		amzDate,
+		req.Header.Get("X-Amz-X509"),
+	)
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", amzDate[:8], region, rolesAnywhereService)
+	stringToSign := strings.Join([]string{
+		algorithm,
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	digest := sha256.Sum256([]byte(stringToSign))
+	signature, err := key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm,
+		cert.SerialNumber.String(),
+		scope,
+		signedHeaders,
+		hex.EncodeToString(signature),
+	))
+
+	return nil
+}
+
+type rolesAnywhereInput struct {
+	Config    *RolesAnywhereConfig `required:"true"`
+	RoleArn   string               `required:"true"`
+	Duration  int
+	Endpoints *EndpointConfig
+}
+
+// Exchange the certificate for role credentials with CreateSession
+func rolesAnywhereCredentials(input rolesAnywhereInput) (*sessionCredentials, error) {
+	cert, key, err := loadX509Identity(input.Config.Certificate, input.Config.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"durationSeconds": input.Duration,
+		"profileArn":      input.Config.ProfileArn,
+		"roleArn":         input.RoleArn,
+		"trustAnchorArn":  input.Config.TrustAnchorArn,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := input.Endpoints.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := sendHTTPRequest(client, true, func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", input.Config.endpoint()+"/sessions", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		if err := signX509Request(req, body, input.Config.region(), cert, key, time.Now()); err != nil {
+			return nil, err
+		}
+
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"roles anywhere CreateSession failed (%d): %s",
+			resp.StatusCode,
+			resp.bodySnippet(),
+		)
+	}
+
+	var out struct {
+		CredentialSet []struct {
+			Credentials struct {
+				AccessKeyID     string    `json:"accessKeyId"`
+				SecretAccessKey string    `json:"secretAccessKey"`
+				SessionToken    string    `json:"sessionToken"`
+				Expiration      time.Time `json:"expiration"`
+			} `json:"credentials"`
+		} `json:"credentialSet"`
+	}
+
+	if err := json.Unmarshal(resp.Body, &out); err != nil {
+		return nil, err
+	}
+
+	if len(out.CredentialSet) == 0 {
+		return nil, fmt.Errorf("roles anywhere CreateSession returned no credentials")
+	}
+
+	creds := out.CredentialSet[0].Credentials
+	return &sessionCredentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Expiration:      creds.Expiration,
+	}, nil
+}
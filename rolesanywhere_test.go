@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Write a self-signed certificate and its key, returning their paths
+func writeTestIdentity(t *testing.T, dir string, key crypto.Signer, keyBlock *pem.Block) (string, string) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(424242),
+		Subject:      pkix.Name{CommonName: "host.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPath := filepath.Join(dir, keyBlock.Type+".crt")
+	keyPath := filepath.Join(dir, keyBlock.Type+".key")
+	ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyPath, pem.EncodeToMemory(keyBlock), 0600)
+
+	return certPath, keyPath
+}
+
+// Verify a SigV4-X509 signature by rebuilding the string to sign
+func verifyX509Request(t *testing.T, r *http.Request, body []byte, pub crypto.PublicKey) {
+	auth := r.Header.Get("Authorization")
+	fields := strings.Split(strings.SplitN(auth, " ", 2)[1], ", ")
+	credential := strings.TrimPrefix(fields[0], "Credential=")
+	signature, _ := hex.DecodeString(strings.TrimPrefix(fields[2], "Signature="))
+
+	if !strings.HasPrefix(credential, "424242/") {
+		t.Errorf("expected the serial number in the credential but got %s", credential)
+	}
+
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.Path,
+		"",
+		"content-type:" + r.Header.Get("Content-Type") + "\nhost:" + r.Host +
+			"\nx-amz-date:" + r.Header.Get("X-Amz-Date") + "\nx-amz-x509:" + r.Header.Get("X-Amz-X509") + "\n",
+		"content-type;host;x-amz-date;x-amz-x509",
+		sha256Hex(body),
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		strings.SplitN(auth, " ", 2)[0],
+		r.Header.Get("X-Amz-Date"),
+		strings.SplitN(credential, "/", 2)[1],
+		sha256Hex([]byte(canonical)),
+	}, "\n")
+	digest := sha256.Sum256([]byte(stringToSign))
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+			t.Error(err)
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+			t.Error("invalid ECDSA signature")
+		}
+	}
+}
+
+func TestRolesAnywhereCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ecDER, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+
+	identities := []struct {
+		key   crypto.Signer
+		block *pem.Block
+	}{
+		{rsaKey, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}},
+		{ecKey, &pem.Block{Type: "PRIVATE KEY", Bytes: ecDER}},
+	}
+
+	for _, identity := range identities {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			verifyX509Request(t, r, body, identity.key.Public())
+
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"credentialSet": []interface{}{
+					map[string]interface{}{
+						"credentials": map[string]interface{}{
+							"accessKeyId":     "ASIAEXAMPLE",
+							"secretAccessKey": "secret",
+							"sessionToken":    "token",
+							"expiration":      "2030-01-01T00:00:00Z",
+						},
+					},
+				},
+			})
+		}))
+
+		certPath, keyPath := writeTestIdentity(t, dir, identity.key, identity.block)
+		creds, err := rolesAnywhereCredentials(rolesAnywhereInput{
+			Config: &RolesAnywhereConfig{
+				Certificate:    certPath,
+				PrivateKey:     keyPath,
+				TrustAnchorArn: "arn:aws:rolesanywhere:us-east-1:123456789012:trust-anchor/abc",
+				ProfileArn:     "arn:aws:rolesanywhere:us-east-1:123456789012:profile/def",
+				Endpoint:       server.URL,
+			},
+			RoleArn:  "arn:aws:iam::123456789012:role/host",
+			Duration: 3600,
+		})
+		server.Close()
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if creds.AccessKeyID != "ASIAEXAMPLE" || creds.Expiration.Year() != 2030 {
+			t.Errorf("unexpected credentials %+v", creds)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	// Source for accounts only reachable through the SAML IdP
+	sourceSAML = "saml"
+
+	samlRoleAttribute = "https://aws.amazon.com/SAML/Attributes/Role"
+)
+
+// Role and identity provider pair granted by a SAML assertion
+type samlRole struct {
+	RoleArn      string
+	PrincipalArn string
+}
+
+type samlResponse struct {
+	Attributes []samlAttribute `xml:"Assertion>AttributeStatement>Attribute"`
+}
+
+type samlAttribute struct {
+	Name   string   `xml:"Name,attr"`
+	Values []string `xml:"AttributeValue"`
+}
+
+// Read a base64 SAMLResponse from a file, from stdin when the path is "-",
+// or from a paste into the terminal when no path is given
+func readSAMLAssertion(path string) (string, error) {
+	var b []byte
+	var err error
+
+	switch {
+	case path == "-":
+		b, err = ioutil.ReadAll(os.Stdin)
+	case path != "":
+		b, err = ioutil.ReadFile(path)
+	case terminal.IsTerminal(int(os.Stdin.Fd())):
+		b, err = readPastedAssertion()
+	default:
+		b, err = ioutil.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	assertion := strings.Join(strings.Fields(string(b)), "")
+	if assertion == "" {
+		return "", fmt.Errorf("SAML assertion is empty")
+	}
+
+	return assertion, nil
+}
+
+// Read pasted lines until an empty line
+func readPastedAssertion() ([]byte, error) {
+	fmt.Fprintln(os.Stderr, "Paste the SAMLResponse followed by an empty line:")
+
+	var lines []string
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			break
+		}
+		lines = append(lines, line)
+	}
+
+	return []byte(strings.Join(lines, "")), scanner.Err()
+}
+
+// Return the role and provider pairs granted by a base64 SAMLResponse
+func parseSAMLRoles(assertion string) ([]samlRole, error) {
+	b, err := base64.StdEncoding.DecodeString(assertion)
+	if err != nil {
+		return nil, fmt.Errorf("SAML assertion is not valid base64: %s", err)
+	}
+
+	var response samlResponse
+	if err := xml.Unmarshal(b, &response); err != nil {
+		return nil, fmt.Errorf("unable to parse SAML assertion: %s", err)
+	}
+
+	roles := []samlRole{}
+	for _, attr := range response.Attributes {
+		if attr.Name != samlRoleAttribute {
+			continue
+		}
+
+		for _, value := range attr.Values {
+			var role samlRole
+
+			// IdPs list the role and provider in either order
+			for _, arn := range strings.Split(strings.TrimSpace(value), ",") {
+				arn = strings.TrimSpace(arn)
+				if strings.Contains(arn, ":saml-provider/") {
+					role.PrincipalArn = arn
+				} else if strings.Contains(arn, ":role/") {
+					role.RoleArn = arn
+				}
+			}
+
+			if role.RoleArn == "" || role.PrincipalArn == "" {
+				return nil, fmt.Errorf("invalid role attribute value %s", value)
+			}
+
+			roles = append(roles, role)
+		}
+	}
+
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("SAML assertion does not grant any roles")
+	}
+
+	return roles, nil
+}
+
+// Return the names of aliases assuming the role, sorted
+func samlAliasNames(config *Config, roleArn string) []string {
+	names := []string{}
+	for _, name := range config.AliasNames() {
+		alias, _, err := config.GetAlias(name)
+		if err == nil && alias.RoleARN() == roleArn {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Return the pair granting a role
+func findSAMLRole(roles []samlRole, roleArn string) (*samlRole, error) {
+	for i := range roles {
+		if roles[i].RoleArn == roleArn {
+			return &roles[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("SAML assertion does not grant role %s", roleArn)
+}
+
+type assumeRoleWithSAMLInput struct {
+	Assertion string    `required:"true"`
+	Role      *samlRole `required:"true"`
+	Duration  int
+	Policy    string
+	Endpoints *EndpointConfig
+}
+
+func assumeRoleWithSAML(input assumeRoleWithSAMLInput) (*sts.AssumeRoleWithSAMLOutput, error) {
+	// The assertion is the only credential, the request itself is unsigned
+	svc, err := newSTSClient(credentials.AnonymousCredentials, input.Endpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	stsInput := &sts.AssumeRoleWithSAMLInput{
+		DurationSeconds: aws.Int64(int64(input.Duration)),
+		PrincipalArn:    aws.String(input.Role.PrincipalArn),
+		RoleArn:         aws.String(input.Role.RoleArn),
+		SAMLAssertion:   aws.String(input.Assertion),
+	}
+
+	if input.Policy != "" {
+		stsInput.Policy = aws.String(input.Policy)
+	}
+
+	ctx, cancel := newRequestContext()
+	defer cancel()
+
+	result, err := svc.AssumeRoleWithSAMLWithContext(ctx, stsInput)
+	return result, requestError(ctx, err)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+const testSAMLResponse = `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol">
+  <saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion">
+    <saml:AttributeStatement>
+      <saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/RoleSessionName">
+        <saml:AttributeValue>jim@example.com</saml:AttributeValue>
+      </saml:Attribute>
+      <saml:Attribute Name="https://aws.amazon.com/SAML/Attributes/Role">
+        <saml:AttributeValue>arn:aws:iam::123456789012:role/admin,arn:aws:iam::123456789012:saml-provider/idp</saml:AttributeValue>
+        <saml:AttributeValue>arn:aws:iam::210987654321:saml-provider/idp,arn:aws:iam::210987654321:role/readonly</saml:AttributeValue>
+      </saml:Attribute>
+    </saml:AttributeStatement>
+  </saml:Assertion>
+</samlp:Response>`
+
+func TestParseSAMLRoles(t *testing.T) {
+	roles, err := parseSAMLRoles(base64.StdEncoding.EncodeToString([]byte(testSAMLResponse)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []samlRole{
+		{
+			RoleArn:      "arn:aws:iam::123456789012:role/admin",
+			PrincipalArn: "arn:aws:iam::123456789012:saml-provider/idp",
+		},
+		{
+			RoleArn:      "arn:aws:iam::210987654321:role/readonly",
+			PrincipalArn: "arn:aws:iam::210987654321:saml-provider/idp",
+		},
+	}
+
+	if len(roles) != len(expected) {
+		t.Fatalf("expected %d roles but got %d", len(expected), len(roles))
+	}
+
+	for i := range expected {
+		if roles[i] != expected[i] {
+			t.Errorf("expected %+v but got %+v", expected[i], roles[i])
+		}
+	}
+
+	if _, err := findSAMLRole(roles, "arn:aws:iam::123456789012:role/readonly"); err == nil {
+		t.Error("expected error but got nil")
+	}
+}
+
+func TestParseSAMLRoles_invalid(t *testing.T) {
+	if _, err := parseSAMLRoles("not base64!"); err == nil {
+		t.Error("expected error but got nil")
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// Prefixes of references to secrets kept outside the configuration file
+const (
+	secretEnvPrefix  = "env:"
+	secretFilePrefix = "file:"
+	secretCmdPrefix  = "cmd:"
+
+	secretCommandTimeout = 30 * time.Second
+)
+
+// Report whether a configuration value refers to a secret stored elsewhere
+func isSecretRef(value string) bool {
+	return strings.HasPrefix(value, secretEnvPrefix) ||
+		strings.HasPrefix(value, secretFilePrefix) ||
+		strings.HasPrefix(value, secretCmdPrefix)
+}
+
+// Return the secret a value refers to: an environment variable, the contents
+// of a file or the output of a command. Other values are the secret itself.
+func resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, secretEnvPrefix):
+		name := strings.TrimPrefix(value, secretEnvPrefix)
+		secret := os.Getenv(name)
+		if secret == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+
+		return secret, nil
+	case strings.HasPrefix(value, secretFilePrefix):
+		path := strings.TrimPrefix(value, secretFilePrefix)
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimSpace(string(b)), nil
+	case strings.HasPrefix(value, secretCmdPrefix):
+		return runSecretCommand(strings.TrimPrefix(value, secretCmdPrefix))
+	}
+
+	return value, nil
+}
+
+// Run a command printing a secret, such as a password manager lookup. Its
+// errors and prompts go to stderr.
+func runSecretCommand(line string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), secretCommandTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	cmd := shellCommand(ctx, line)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("secret command timed out after %s", secretCommandTimeout)
+		}
+		return "", fmt.Errorf("secret command failed: %s", err)
+	}
+
+	secret := strings.TrimSpace(out.String())
+	if secret == "" {
+		return "", fmt.Errorf("secret command printed nothing")
+	}
+
+	return secret, nil
+}
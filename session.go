@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const (
+	sessionsDirName        = "sessions"
+	defaultSessionDuration = 43200
+	maxSessionDuration     = 129600
+
+	// Stored sessions closer than this to expiring are replaced
+	sessionRefreshWindow = 5 * time.Minute
+)
+
+// Temporary credentials issued by STS
+type sessionCredentials struct {
+	AccessKeyID     string    `json:"access_key_id"`
+	SecretAccessKey string    `json:"secret_access_key"`
+	SessionToken    string    `json:"session_token"`
+	Expiration      time.Time `json:"expiration"`
+}
+
+func newSessionCredentials(c *sts.Credentials) *sessionCredentials {
+	return &sessionCredentials{
+		AccessKeyID:     aws.StringValue(c.AccessKeyId),
+		SecretAccessKey: aws.StringValue(c.SecretAccessKey),
+		SessionToken:    aws.StringValue(c.SessionToken),
+		Expiration:      aws.TimeValue(c.Expiration),
+	}
+}
+
+// Return a provider for the credentials
+func (s *sessionCredentials) provider() *credentials.Credentials {
+	return credentials.NewStaticCredentials(s.AccessKeyID, s.SecretAccessKey, s.SessionToken)
+}
+
+// Report whether the credentials expire within the given duration
+func (s *sessionCredentials) expiresWithin(d time.Duration) bool {
+	return time.Now().Add(d).After(s.Expiration)
+}
+
+// Return the encrypted file holding the session for a long-term key and
+// the MFA device it was requested with
+func sessionPath(dir, accessKeyID, deviceID string) string {
+	name := accessKeyID
+	if deviceID != "" {
+		sum := sha256.Sum256([]byte(deviceID))
+		name += "-" + hex.EncodeToString(sum[:4])
+	}
+
+	return filepath.Join(dir, sessionsDirName, name+".json")
+}
+
+// Remove the stored sessions of a long-term key for all devices
+func removeSessions(dir, accessKeyID string) {
+	paths, _ := filepath.Glob(filepath.Join(dir, sessionsDirName, accessKeyID+"*.json"))
+	for _, path := range paths {
+		os.Remove(path)
+	}
+}
+
+// Load a stored session, returning nil if none exists or it can not be
+// decrypted with the current key
+func loadSession(path string, key []byte) *sessionCredentials {
+	var creds sessionCredentials
+
+	found, err := readSealed(path, key, &creds)
+	if err != nil || !found {
+		return nil
+	}
+
+	return &creds
+}
+
+type sessionTokenInput struct {
+	Credentials    *credentials.Credentials `required:"true"`
+	AWSAccessKeyID string                   `required:"true"`
+	MFADeviceID    string
+	MFAToken       mfaToken
+	StateDir       string `required:"true"`
+	Duration       int
+	Lock           lockOptions
+	Endpoints      *EndpointConfig
+}
+
+func getSessionToken(input sessionTokenInput) (*sessionCredentials, error) {
+	svc, err := newSTSClient(input.Credentials, input.Endpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	duration := input.Duration
+	if duration == 0 {
+		duration = defaultSessionDuration
+	}
+
+	stsInput := &sts.GetSessionTokenInput{
+		DurationSeconds: aws.Int64(int64(duration)),
+	}
+
+	var result *sts.GetSessionTokenOutput
+	send := func(opts ...request.Option) error {
+		ctx, cancel := newRequestContext()
+		defer cancel()
+
+		result, err = svc.GetSessionTokenWithContext(ctx, stsInput, opts...)
+		return requestError(ctx, err)
+	}
+
+	if input.MFADeviceID == "" {
+		err = send()
+	} else {
+		stsInput.SerialNumber = aws.String(input.MFADeviceID)
+		err = withMFAToken(input.StateDir, input.MFADeviceID, input.MFAToken, func(code string) error {
+			stsInput.TokenCode = aws.String(code)
+			return send(withoutRetries)
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newSessionCredentials(result.Credentials), nil
+}
+
+// Return the stored session for the long-term keys, requesting a new one
+// from STS when it is missing or about to expire. The MFA token is only
+// requested when a new session is needed.
+func mfaSession(input sessionTokenInput) (*sessionCredentials, error) {
+	path := sessionPath(input.StateDir, input.AWSAccessKeyID, input.MFADeviceID)
+
+	key, err := loadStateKey(input.StateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := loadSession(path, key)
+	if creds != nil && !creds.expiresWithin(sessionRefreshWindow) {
+		return creds, nil
+	}
+
+	// Only one process prompts for MFA, others use the session it stores
+	lock, err := acquireLock(lockPath(input.StateDir, "session-"+input.AWSAccessKeyID), input.Lock)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	creds = loadSession(path, key)
+	if creds != nil && !creds.expiresWithin(sessionRefreshWindow) {
+		return creds, nil
+	}
+
+	creds, err = getSessionToken(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeSealed(path, key, creds); err != nil {
+		return nil, err
+	}
+
+	return creds, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestSessionPath(t *testing.T) {
+	dir := "state"
+	phone := "arn:aws:iam::123456789012:mfa/phone"
+	yubikey := "arn:aws:iam::123456789012:mfa/yubikey"
+
+	if path := sessionPath(dir, "AKIAEXAMPLE", ""); path != filepath.Join(dir, sessionsDirName, "AKIAEXAMPLE.json") {
+		t.Errorf("unexpected path %s for a session without a device", path)
+	}
+
+	paths := map[string]bool{
+		sessionPath(dir, "AKIAEXAMPLE", ""):      true,
+		sessionPath(dir, "AKIAEXAMPLE", phone):   true,
+		sessionPath(dir, "AKIAEXAMPLE", yubikey): true,
+		sessionPath(dir, "AKIAOTHER", phone):     true,
+	}
+	if len(paths) != 4 {
+		t.Errorf("expected a path per access key and device but got %v", paths)
+	}
+}
+
+func TestRemoveSessions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, sessionsDirName), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	paths := []string{
+		sessionPath(dir, "AKIAEXAMPLE", ""),
+		sessionPath(dir, "AKIAEXAMPLE", "arn:aws:iam::123456789012:mfa/phone"),
+		sessionPath(dir, "AKIAOTHER", ""),
+	}
+	for _, path := range paths {
+		if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removeSessions(dir, "AKIAEXAMPLE")
+
+	for i, path := range paths {
+		_, err := os.Stat(path)
+		if removed := os.IsNotExist(err); removed != (i < 2) {
+			t.Errorf("unexpected state of %s, removed: %t", path, removed)
+		}
+	}
+}
+
+func TestMFASession(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("Action") != "GetSessionToken" || r.Form.Get("TokenCode") != "123456" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		n := atomic.AddInt32(&calls, 1)
+		fmt.Fprintf(w, `<GetSessionTokenResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetSessionTokenResult>
+    <Credentials>
+      <AccessKeyId>ASIA%d</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </GetSessionTokenResult>
+</GetSessionTokenResponse>`, n, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	asked := 0
+	input := sessionTokenInput{
+		Credentials:    credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""),
+		AWSAccessKeyID: "AKIAEXAMPLE",
+		MFADeviceID:    "arn:aws:iam::123456789012:mfa/jim",
+		MFAToken: mfaToken{
+			Code: func() (string, error) {
+				asked++
+				return "123456", nil
+			},
+			Fixed: true,
+		},
+		StateDir:  dir,
+		Endpoints: &EndpointConfig{STSEndpoint: server.URL},
+	}
+
+	creds, err := mfaSession(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if creds.AccessKeyID != "ASIA1" || calls != 1 || asked != 1 {
+		t.Fatalf("expected a new session but got %s after %d calls and %d tokens", creds.AccessKeyID, calls, asked)
+	}
+
+	// A valid stored session is reused without asking for a token
+	creds, err = mfaSession(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if creds.AccessKeyID != "ASIA1" || calls != 1 || asked != 1 {
+		t.Errorf("expected the stored session but got %s after %d calls and %d tokens", creds.AccessKeyID, calls, asked)
+	}
+
+	// A session inside the refresh window is replaced
+	key, err := loadStateKey(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds.Expiration = time.Now().Add(sessionRefreshWindow / 2)
+	if err := writeSealed(sessionPath(dir, "AKIAEXAMPLE", input.MFADeviceID), key, creds); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err = mfaSession(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if creds.AccessKeyID != "ASIA2" || calls != 2 || asked != 2 {
+		t.Errorf("expected a refreshed session but got %s after %d calls and %d tokens", creds.AccessKeyID, calls, asked)
+	}
+
+	// Sessions are stored per device
+	input.MFADeviceID = "arn:aws:iam::123456789012:mfa/yubikey"
+	if creds, err = mfaSession(input); err != nil {
+		t.Fatal(err)
+	}
+
+	if creds.AccessKeyID != "ASIA3" || asked != 3 {
+		t.Errorf("expected a session for the other device but got %s", creds.AccessKeyID)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const (
+	defaultSessionNameTemplate = "{{with .User}}{{.}}@{{end}}{{.Role}}_{{.Timestamp}}"
+
+	// STS limits role session names to 2-64 characters
+	minSessionNameLength = 2
+	maxSessionNameLength = 64
+	fallbackSessionName  = "aws-session"
+)
+
+var invalidSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
+type sessionNameInput struct {
+	Template    string
+	Alias       string
+	Role        string
+	MFADeviceID string
+	Reason      string
+
+	// Used to look up the user when the MFA device does not name one,
+	// nil for credentials that can not call GetCallerIdentity
+	Credentials *credentials.Credentials
+	Endpoints   *EndpointConfig
+}
+
+// Values available to session name templates. User is only looked up when
+// a template uses it.
+type sessionNameVars struct {
+	input     sessionNameInput
+	Alias     string
+	Role      string
+	Reason    string
+	Timestamp string
+}
+
+// Return the IAM user from the MFA device ARN, or the name of the caller
+// when the device is a hardware serial number or there is none. Empty when
+// the caller can not be looked up.
+func (v *sessionNameVars) User() string {
+	if i := strings.Index(v.input.MFADeviceID, ":mfa/"); i >= 0 {
+		path := v.input.MFADeviceID[i+len(":mfa/"):]
+		return path[strings.LastIndex(path, "/")+1:]
+	}
+
+	if v.input.Credentials == nil {
+		return ""
+	}
+
+	name, err := callerName(v.input.Credentials, v.input.Endpoints)
+	if err != nil {
+		return ""
+	}
+
+	return name
+}
+
+func (v *sessionNameVars) OSUser() string {
+	if u, err := user.Current(); err == nil {
+		// Windows account names include the domain
+		return u.Username[strings.LastIndex(u.Username, `\`)+1:]
+	}
+
+	return ""
+}
+
+func (v *sessionNameVars) Hostname() string {
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// Return the name of the caller from GetCallerIdentity: the user name for
+// IAM users and the session name for assumed roles
+func callerName(creds *credentials.Credentials, endpoints *EndpointConfig) (string, error) {
+	svc, err := newSTSClient(creds, endpoints)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := newRequestContext()
+	defer cancel()
+
+	identity, err := svc.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", requestError(ctx, err)
+	}
+
+	arn := aws.StringValue(identity.Arn)
+	if strings.HasSuffix(arn, ":root") {
+		return "root", nil
+	}
+
+	return arn[strings.LastIndex(arn, "/")+1:], nil
+}
+
+// Replace characters STS does not allow in session names and limit the length
+func sanitizeSessionName(name string) string {
+	name = invalidSessionNameChars.ReplaceAllString(name, "-")
+	if len(name) > maxSessionNameLength {
+		name = name[:maxSessionNameLength]
+	}
+
+	if len(name) < minSessionNameLength {
+		return fallbackSessionName
+	}
+
+	return name
+}
+
+// Render the session name template, the default one when none is set
+func generateSessionName(input sessionNameInput) (string, error) {
+	// The default template only names the user from the MFA device, the
+	// caller is looked up for templates that ask for it
+	text := input.Template
+	if text == "" {
+		text = defaultSessionNameTemplate
+		input.Credentials = nil
+	}
+
+	tmpl, err := template.New("session_name").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid session_name_template: %s", err)
+	}
+
+	var b bytes.Buffer
+	err = tmpl.Execute(&b, &sessionNameVars{
+		input:     input,
+		Alias:     input.Alias,
+		Role:      input.Role,
+		Reason:    input.Reason,
+		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+	})
+	if err != nil {
+		return "", fmt.Errorf("rendering session_name_template: %s", err)
+	}
+
+	return sanitizeSessionName(b.String()), nil
+}
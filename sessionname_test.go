@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestGenerateSessionName(t *testing.T) {
+	tests := []struct {
+		input    sessionNameInput
+		expected string
+	}{
+		{sessionNameInput{Role: "Admin", MFADeviceID: "arn:aws:iam::123456789012:mfa/jim"}, "jim@Admin_"},
+		{sessionNameInput{Role: "Admin", MFADeviceID: "arn:aws:iam::123456789012:mfa/team/ops/jim"}, "jim@Admin_"},
+		{sessionNameInput{Role: "Admin", MFADeviceID: "GAHT12345678"}, "Admin_"},
+		{sessionNameInput{Role: "Admin"}, "Admin_"},
+		{sessionNameInput{Template: "{{.Alias}}/{{.Reason}}", Alias: "prod", Reason: "ticket #42"}, "prod-ticket--42"},
+	}
+
+	for _, test := range tests {
+		name, err := generateSessionName(test.input)
+		if err != nil {
+			t.Errorf("unexpected error for %+v: %s", test.input, err)
+			continue
+		}
+
+		if !strings.HasPrefix(name, test.expected) {
+			t.Errorf("expected a name starting with %s but got %s", test.expected, name)
+		}
+	}
+
+	name, err := generateSessionName(sessionNameInput{Template: strings.Repeat("x", 100)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(name) != maxSessionNameLength {
+		t.Errorf("expected a name of %d characters but got %d", maxSessionNameLength, len(name))
+	}
+
+	if name := sanitizeSessionName(""); name != fallbackSessionName {
+		t.Errorf("expected %s for an empty name but got %s", fallbackSessionName, name)
+	}
+}
+
+func TestGenerateSessionName_user(t *testing.T) {
+	var calls int32
+	failing := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if failing {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		fmt.Fprint(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>arn:aws:iam::123456789012:user/ops/jim</Arn>
+    <UserId>AIDAEXAMPLE</UserId>
+    <Account>123456789012</Account>
+  </GetCallerIdentityResult>
+</GetCallerIdentityResponse>`)
+	}))
+	defer server.Close()
+
+	input := sessionNameInput{
+		Role:        "Admin",
+		Credentials: credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""),
+		Endpoints:   &EndpointConfig{STSEndpoint: server.URL},
+	}
+
+	// The default template does not look up the caller
+	if name, err := generateSessionName(input); err != nil || !strings.HasPrefix(name, "Admin_") || calls != 0 {
+		t.Errorf("expected Admin_ without calling STS but got %s, %v after %d calls", name, err, calls)
+	}
+
+	input.Template = "{{.User}}@{{.Role}}"
+	if name, err := generateSessionName(input); err != nil || name != "jim@Admin" || calls != 1 {
+		t.Errorf("expected jim@Admin from STS but got %s, %v after %d calls", name, err, calls)
+	}
+
+	failing = true
+	if name, err := generateSessionName(input); err != nil || name != "@Admin" {
+		t.Errorf("expected an empty user when STS fails but got %s, %v", name, err)
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	ssoDirName    = "sso"
+	ssoClientName = "aws-session"
+	ssoGrantType  = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// Tokens closer than this to expiring trigger a new login
+	ssoTokenRefreshWindow = 5 * time.Minute
+	ssoDefaultInterval    = 5 * time.Second
+
+	// Device codes usually expire after 10 minutes, logins are not waited
+	// on for longer even when the code has no expiry
+	ssoMaxLoginWait = 10 * time.Minute
+)
+
+type SSOConfig struct {
+	StartURL string `yaml:"start_url" required:"true"`
+	Region   string `yaml:"region" required:"true"`
+	Endpoint string `yaml:"endpoint"`
+}
+
+// Return the OIDC and portal endpoints, which share the configured
+// endpoint when one is set
+func (s *SSOConfig) endpoints() (string, string) {
+	if s.Endpoint != "" {
+		endpoint := strings.TrimSuffix(s.Endpoint, "/")
+		return endpoint, endpoint
+	}
+
+	return fmt.Sprintf("https://oidc.%s.amazonaws.com", s.Region),
+		fmt.Sprintf("https://portal.sso.%s.amazonaws.com", s.Region)
+}
+
+// Registered client and access token stored for a start URL
+type ssoToken struct {
+	ClientID              string    `json:"client_id"`
+	ClientSecret          string    `json:"client_secret"`
+	ClientSecretExpiresAt time.Time `json:"client_secret_expires_at"`
+	AccessToken           string    `json:"access_token"`
+	ExpiresAt             time.Time `json:"expires_at"`
+}
+
+func (t *ssoToken) clientValid() bool {
+	return t.ClientID != "" && time.Now().Add(ssoTokenRefreshWindow).Before(t.ClientSecretExpiresAt)
+}
+
+func (t *ssoToken) tokenValid() bool {
+	return t.AccessToken != "" && time.Now().Add(ssoTokenRefreshWindow).Before(t.ExpiresAt)
+}
+
+// Error response returned by the OIDC service
+type ssoError struct {
+	StatusCode  int
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *ssoError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("sso request failed (%d): %s: %s", e.StatusCode, e.Code, e.Description)
+	}
+
+	return fmt.Sprintf("sso request failed (%d): %s", e.StatusCode, e.Code)
+}
+
+// Send a JSON request to the SSO services and decode the response
+func ssoRequest(client *http.Client, method, endpoint string, header http.Header, body, out interface{}) error {
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	resp, err := sendHTTPRequest(client, true, func() (*http.Request, error) {
+		req, err := http.NewRequest(method, endpoint, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		ssoErr := &ssoError{StatusCode: resp.StatusCode}
+		json.Unmarshal(resp.Body, ssoErr)
+
+		// Some services only report the error type in a header
+		if ssoErr.Code == "" {
+			ssoErr.Code = resp.Header.Get("X-Amzn-Errortype")
+		}
+		if ssoErr.Code == "" {
+			ssoErr.Code = http.StatusText(resp.StatusCode)
+		}
+
+		return ssoErr
+	}
+
+	if err := json.Unmarshal(resp.Body, out); err != nil {
+		return fmt.Errorf("unexpected sso response from %s (%d): %s", endpoint, resp.StatusCode, resp.bodySnippet())
+	}
+
+	return nil
+}
+
+// Return the file storing the token for a start URL
+func ssoTokenPath(stateDir, startURL string) string {
+	sum := sha256.Sum256([]byte(startURL))
+	return filepath.Join(stateDir, ssoDirName, hex.EncodeToString(sum[:]))
+}
+
+func registerSSOClient(client *http.Client, oidcEndpoint string, token *ssoToken) error {
+	var out struct {
+		ClientID              string `json:"clientId"`
+		ClientSecret          string `json:"clientSecret"`
+		ClientSecretExpiresAt int64  `json:"clientSecretExpiresAt"`
+	}
+
+	err := ssoRequest(client, "POST", oidcEndpoint+"/client/register", nil, map[string]string{
+		"clientName": ssoClientName,
+		"clientType": "public",
+	}, &out)
+	if err != nil {
+		return err
+	}
+
+	token.ClientID = out.ClientID
+	token.ClientSecret = out.ClientSecret
+	token.ClientSecretExpiresAt = time.Unix(out.ClientSecretExpiresAt, 0)
+
+	return nil
+}
+
+// Run the device authorization flow, printing the code the user confirms
+// in the browser and polling until the login completes
+func ssoDeviceLogin(client *http.Client, config *SSOConfig, token *ssoToken) error {
+	oidcEndpoint, _ := config.endpoints()
+
+	if !token.clientValid() {
+		if err := registerSSOClient(client, oidcEndpoint, token); err != nil {
+			return err
+		}
+	}
+
+	var auth struct {
+		DeviceCode              string `json:"deviceCode"`
+		UserCode                string `json:"userCode"`
+		VerificationURI         string `json:"verificationUri"`
+		VerificationURIComplete string `json:"verificationUriComplete"`
+		ExpiresIn               int    `json:"expiresIn"`
+		Interval                int    `json:"interval"`
+	}
+
+	err := ssoRequest(client, "POST", oidcEndpoint+"/device_authorization", nil, map[string]string{
+		"clientId":     token.ClientID,
+		"clientSecret": token.ClientSecret,
+		"startUrl":     config.StartURL,
+	}, &auth)
+	if err != nil {
+		return err
+	}
+
+	verificationURI := auth.VerificationURIComplete
+	if verificationURI == "" {
+		verificationURI = auth.VerificationURI
+	}
+	fmt.Fprintf(
+		os.Stderr,
+		"Open %s in a browser and confirm the code %s\n",
+		verificationURI,
+		auth.UserCode,
+	)
+
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval == 0 {
+		interval = ssoDefaultInterval
+	}
+	wait := time.Duration(auth.ExpiresIn) * time.Second
+	if wait <= 0 || wait > ssoMaxLoginWait {
+		wait = ssoMaxLoginWait
+	}
+	deadline := time.Now().Add(wait)
+
+	for {
+		time.Sleep(interval)
+
+		var out struct {
+			AccessToken string `json:"accessToken"`
+			ExpiresIn   int    `json:"expiresIn"`
+		}
+
+		err := ssoRequest(client, "POST", oidcEndpoint+"/token", nil, map[string]string{
+			"clientId":     token.ClientID,
+			"clientSecret": token.ClientSecret,
+			"deviceCode":   auth.DeviceCode,
+			"grantType":    ssoGrantType,
+		}, &out)
+		if err == nil {
+			token.AccessToken = out.AccessToken
+			token.ExpiresAt = time.Now().Add(time.Duration(out.ExpiresIn) * time.Second)
+			return nil
+		}
+
+		ssoErr, ok := err.(*ssoError)
+		if !ok {
+			return err
+		}
+
+		switch {
+		case strings.Contains(ssoErr.Code, "authorization_pending"), strings.HasPrefix(ssoErr.Code, "AuthorizationPending"):
+		case strings.Contains(ssoErr.Code, "slow_down"), strings.HasPrefix(ssoErr.Code, "SlowDown"):
+			interval += ssoDefaultInterval
+		default:
+			return err
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("sso login was not confirmed before the code expired")
+		}
+	}
+}
+
+// Return a valid access token for the start URL, logging in when the
+// stored token is missing or expired
+func ssoAccessToken(client *http.Client, config *SSOConfig, stateDir string, lockOpts lockOptions) (string, error) {
+	path := ssoTokenPath(stateDir, config.StartURL)
+
+	key, err := loadStateKey(stateDir)
+	if err != nil {
+		return "", err
+	}
+
+	var token ssoToken
+	if found, err := readSealed(path, key, &token); err == nil && found && token.tokenValid() {
+		return token.AccessToken, nil
+	}
+
+	// Only one process runs the device flow, others use the token it stores
+	lock, err := acquireLock(lockPath(stateDir, "sso-"+filepath.Base(path)), ssoLockOptions(lockOpts))
+	if err != nil {
+		return "", err
+	}
+	defer lock.Release()
+
+	token = ssoToken{}
+	if found, err := readSealed(path, key, &token); err == nil && found && token.tokenValid() {
+		return token.AccessToken, nil
+	}
+
+	if err := ssoDeviceLogin(client, config, &token); err != nil {
+		return "", err
+	}
+
+	if err := writeSealed(path, key, &token); err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, nil
+}
+
+// Return lock settings that let waiting processes, and the lock itself,
+// outlast a login in the browser
+func ssoLockOptions(opts lockOptions) lockOptions {
+	wait := ssoMaxLoginWait + time.Minute
+	if opts.Timeout < wait {
+		opts.Timeout = wait
+	}
+	if opts.StaleAfter < wait {
+		opts.StaleAfter = wait
+	}
+
+	return opts
+}
+
+type ssoRoleCredentialsInput struct {
+	Config        *SSOConfig `required:"true"`
+	AccountNumber string     `required:"true"`
+	RoleName      string     `required:"true"`
+	StateDir      string     `required:"true"`
+	Lock          lockOptions
+	Endpoints     *EndpointConfig
+}
+
+// Fetch credentials for an account and permission set with GetRoleCredentials
+func ssoRoleCredentials(input ssoRoleCredentialsInput) (*sessionCredentials, error) {
+	client, err := input.Endpoints.httpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := ssoAccessToken(client, input.Config, input.StateDir, input.Lock)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := getSSORoleCredentials(client, input, accessToken)
+
+	// Tokens revoked before they expire need a new login
+	if ssoErr, ok := err.(*ssoError); ok && ssoErr.StatusCode == http.StatusUnauthorized {
+		os.Remove(ssoTokenPath(input.StateDir, input.Config.StartURL))
+
+		accessToken, err = ssoAccessToken(client, input.Config, input.StateDir, input.Lock)
+		if err != nil {
+			return nil, err
+		}
+
+		creds, err = getSSORoleCredentials(client, input, accessToken)
+	}
+
+	return creds, err
+}
+
+func getSSORoleCredentials(client *http.Client, input ssoRoleCredentialsInput, accessToken string) (*sessionCredentials, error) {
+	_, portalEndpoint := input.Config.endpoints()
+	params := url.Values{}
+	params.Set("account_id", input.AccountNumber)
+	params.Set("role_name", input.RoleName)
+
+	var out struct {
+		RoleCredentials struct {
+			AccessKeyID     string `json:"accessKeyId"`
+			SecretAccessKey string `json:"secretAccessKey"`
+			SessionToken    string `json:"sessionToken"`
+			Expiration      int64  `json:"expiration"`
+		} `json:"roleCredentials"`
+	}
+
+	header := http.Header{}
+	header.Set("X-Amz-Sso_bearer_token", accessToken)
+
+	err := ssoRequest(
+		client,
+		"GET",
+		portalEndpoint+"/federation/credentials?"+params.Encode(),
+		header,
+		nil,
+		&out,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sessionCredentials{
+		AccessKeyID:     out.RoleCredentials.AccessKeyID,
+		SecretAccessKey: out.RoleCredentials.SecretAccessKey,
+		SessionToken:    out.RoleCredentials.SessionToken,
+		Expiration:      time.Unix(0, out.RoleCredentials.Expiration*int64(time.Millisecond)),
+	}, nil
+}
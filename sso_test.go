@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestSSORoleCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logins := 0
+	pending := true
+	expiration := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/client/register", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"clientId":              "client",
+			"clientSecret":          "secret",
+			"clientSecretExpiresAt": time.Now().Add(24 * time.Hour).Unix(),
+		})
+	})
+	mux.HandleFunc("/device_authorization", func(w http.ResponseWriter, r *http.Request) {
+		logins++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"deviceCode":      "device",
+			"userCode":        "ABCD-EFGH",
+			"verificationUri": "https://device.sso.example.com",
+			"expiresIn":       60,
+			"interval":        1,
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if pending {
+			pending = false
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "authorization_pending"})
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"accessToken": "access-token",
+			"expiresIn":   3600,
+		})
+	})
+	mux.HandleFunc("/federation/credentials", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Sso_bearer_token") != "access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.URL.Query().Get("account_id") != "123456789012" || r.URL.Query().Get("role_name") != "ReadOnly" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"roleCredentials": map[string]interface{}{
+				"accessKeyId":     "ASIAEXAMPLE",
+				"secretAccessKey": "secret",
+				"sessionToken":    "token",
+				"expiration":      expiration.UnixNano() / int64(time.Millisecond),
+			},
+		})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	input := ssoRoleCredentialsInput{
+		Config: &SSOConfig{
+			StartURL: "https://example.awsapps.com/start",
+			Region:   "us-east-1",
+			Endpoint: server.URL,
+		},
+		AccountNumber: "123456789012",
+		RoleName:      "ReadOnly",
+		StateDir:      dir,
+	}
+
+	for i := 0; i < 2; i++ {
+		creds, err := ssoRoleCredentials(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if creds.AccessKeyID != "ASIAEXAMPLE" || !creds.Expiration.Equal(expiration) {
+			t.Errorf("unexpected credentials %+v", creds)
+		}
+	}
+
+	if logins != 1 {
+		t.Errorf("expected the stored token to be reused but logged in %d times", logins)
+	}
+}
+
+func TestSSOLockOptions(t *testing.T) {
+	opts := ssoLockOptions(lockOptions{})
+	if opts.Timeout <= ssoMaxLoginWait || opts.StaleAfter <= ssoMaxLoginWait {
+		t.Errorf("expected the lock to outlast a %s login but got %+v", ssoMaxLoginWait, opts)
+	}
+
+	long := lockOptions{Timeout: time.Hour, StaleAfter: 2 * time.Hour}
+	if opts := ssoLockOptions(long); opts != long {
+		t.Errorf("expected longer settings to be kept but got %+v", opts)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTOTPDigits    = 6
+	defaultTOTPPeriod    = 30
+	defaultTOTPAlgorithm = "SHA1"
+)
+
+// Seed of a virtual MFA device used to generate token codes instead of
+// prompting for them. Generation only happens once enabled is set.
+type TOTPConfig struct {
+	Seed           string `yaml:"seed" required:"true"`
+	Enabled        bool   `yaml:"enabled"`
+	AllowPlaintext bool   `yaml:"allow_plaintext"`
+	Digits         int    `yaml:"digits"`
+	Period         int    `yaml:"period"`
+	Algorithm      string `yaml:"algorithm"`
+}
+
+// Report whether token codes should be generated from the seed
+func (t *TOTPConfig) enabled() bool {
+	return t != nil && t.Enabled
+}
+
+func (t *TOTPConfig) digits() int {
+	if t.Digits == 0 {
+		return defaultTOTPDigits
+	}
+
+	return t.Digits
+}
+
+func (t *TOTPConfig) period() time.Duration {
+	if t.Period == 0 {
+		return defaultTOTPPeriod * time.Second
+	}
+
+	return time.Duration(t.Period) * time.Second
+}
+
+func (t *TOTPConfig) hash() (func() hash.Hash, error) {
+	switch strings.ToUpper(t.Algorithm) {
+	case "", defaultTOTPAlgorithm:
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	}
+
+	return nil, fmt.Errorf("unsupported mfa_totp algorithm %s, must be one of SHA1, SHA256 or SHA512", t.Algorithm)
+}
+
+// Check the settings without resolving the seed
+func (t *TOTPConfig) validate() error {
+	if err := Validate(*t); err != nil {
+		return err
+	}
+
+	if !isSecretRef(t.Seed) && !t.AllowPlaintext {
+		return fmt.Errorf(
+			"mfa_totp seed must be an %s, %s or %s reference, set allow_plaintext to store it in the config",
+			secretEnvPrefix,
+			secretFilePrefix,
+			secretCmdPrefix,
+		)
+	}
+
+	if d := t.digits(); d != 6 && d != 8 {
+		return fmt.Errorf("mfa_totp digits must be 6 or 8")
+	}
+
+	if t.Period < 0 {
+		return fmt.Errorf("mfa_totp period must be positive")
+	}
+
+	_, err := t.hash()
+	return err
+}
+
+// Decode a base32 seed as shown by authenticator setup pages, ignoring
+// case, spaces and padding
+func decodeTOTPSeed(seed string) ([]byte, error) {
+	seed = strings.ToUpper(strings.Replace(seed, " ", "", -1))
+	seed = strings.TrimRight(seed, "=")
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(seed)
+	if err != nil {
+		return nil, fmt.Errorf("mfa_totp seed is not valid base32")
+	}
+
+	return key, nil
+}
+
+// Return the RFC 6238 code for a time
+func totpCode(key []byte, now time.Time, period time.Duration, digits int, h func() hash.Hash) string {
+	counter := uint64(now.Unix() / int64(period/time.Second))
+
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(h, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation from RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// Resolve the seed and return the current token code
+func (t *TOTPConfig) token() (string, error) {
+	h, err := t.hash()
+	if err != nil {
+		return "", err
+	}
+
+	seed, err := resolveSecret(t.Seed)
+	if err != nil {
+		return "", fmt.Errorf("mfa_totp seed: %s", err)
+	}
+
+	key, err := decodeTOTPSeed(seed)
+	if err != nil {
+		return "", err
+	}
+
+	return totpCode(key, time.Now(), t.period(), t.digits(), h), nil
+}
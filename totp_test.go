@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"hash"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// Test vectors from RFC 6238 appendix B
+	tests := []struct {
+		key      string
+		h        func() hash.Hash
+		unix     int64
+		expected string
+	}{
+		{"12345678901234567890", sha1.New, 59, "94287082"},
+		{"12345678901234567890", sha1.New, 1111111109, "07081804"},
+		{"12345678901234567890123456789012", sha256.New, 59, "46119246"},
+		{"1234567890123456789012345678901234567890123456789012345678901234", sha512.New, 59, "90693936"},
+	}
+
+	for _, test := range tests {
+		code := totpCode([]byte(test.key), time.Unix(test.unix, 0), 30*time.Second, 8, test.h)
+		if code != test.expected {
+			t.Errorf("expected %s at %d but got %s", test.expected, test.unix, code)
+		}
+	}
+}
+
+func TestTOTPConfig(t *testing.T) {
+	seed := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	plaintext := &TOTPConfig{Seed: seed, Enabled: true}
+	if err := plaintext.validate(); err == nil {
+		t.Error("expected error for a plaintext seed without allow_plaintext")
+	}
+
+	os.Setenv("AWS_SESSION_TEST_SEED", seed)
+	defer os.Unsetenv("AWS_SESSION_TEST_SEED")
+
+	config := &TOTPConfig{Seed: "env:AWS_SESSION_TEST_SEED", Enabled: true}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := config.token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(code) != defaultTOTPDigits {
+		t.Errorf("expected a %d digit code but got %s", defaultTOTPDigits, code)
+	}
+
+	if err := (&TOTPConfig{Seed: "env:X", Digits: 7}).validate(); err == nil {
+		t.Error("expected error for 7 digits")
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	os.Setenv("AWS_SESSION_TEST_SECRET", "from-env")
+	defer os.Unsetenv("AWS_SESSION_TEST_SECRET")
+
+	tests := map[string]string{
+		"plain":                       "plain",
+		"env:AWS_SESSION_TEST_SECRET": "from-env",
+		"cmd:echo from-command":       "from-command",
+	}
+
+	for value, expected := range tests {
+		secret, err := resolveSecret(value)
+		if err != nil {
+			t.Errorf("unexpected error for %s: %s", value, err)
+		} else if secret != expected {
+			t.Errorf("expected %s for %s but got %s", expected, value, secret)
+		}
+	}
+
+	if _, err := resolveSecret("env:AWS_SESSION_TEST_UNSET"); err == nil {
+		t.Error("expected error for an unset variable")
+	}
+}
@@ -3,22 +3,24 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/exec"
 	"path"
 	"syscall"
 
 	"golang.org/x/crypto/ssh/terminal"
 )
 
-func promptMFAToken() (string, error) {
+func promptMFAToken(prompt string) (string, error) {
 	// Using dev tty
 	tty, err := os.OpenFile("/dev/tty", os.O_RDWR|syscall.O_NOCTTY, 0)
 	if err != nil {
 		return "", err
 	}
 
-	fmt.Fprintf(tty, "MFA Token: ")
+	fmt.Fprint(tty, prompt)
 	pass, err := terminal.ReadPassword(int(tty.Fd()))
 	if err != nil {
 		return string(pass), err
@@ -31,3 +33,27 @@ func promptMFAToken() (string, error) {
 func defaultConfig() string {
 	return path.Join(os.Getenv("HOME"), ConfigFilename)
 }
+
+// Report whether a process with the pid is running
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// Return a command running a line with the user's shell
+func shellCommand(ctx context.Context, line string) *exec.Cmd {
+	return exec.CommandContext(ctx, "/bin/sh", "-c", line)
+}
+
+// Signals passed on to commands run by exec and shell. Ctrl-C already
+// reaches them through the terminal.
+var forwardedSignals = []os.Signal{syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGUSR1, syscall.SIGUSR2}
+
+// Return the user's login shell
+func userShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+
+	return "/bin/sh"
+}
@@ -3,16 +3,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"syscall"
 
 	"golang.org/x/crypto/ssh/terminal"
 )
 
-func promptMFAToken() (string, error) {
-	fmt.Printf("MFA Token: ")
+func promptMFAToken(prompt string) (string, error) {
+	fmt.Print(prompt)
 	pass, err := terminal.ReadPassword(int(syscall.Stdin))
 	if err != nil {
 		return string(pass), err
@@ -29,3 +31,42 @@ func defaultConfig() string {
 		ConfigFilename,
 	)
 }
+
+// Exit code reported by GetExitCodeProcess for running processes
+const stillActive = 259
+
+// Report whether a process with the pid is running
+func processAlive(pid int) bool {
+	h, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err == syscall.ERROR_ACCESS_DENIED {
+		return true
+	} else if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(h)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+
+	return code == stillActive
+}
+
+// Return a command running a line with cmd.exe
+func shellCommand(ctx context.Context, line string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", line)
+}
+
+// Windows processes can only be killed, Ctrl-C already reaches commands run
+// by exec and shell through the console
+var forwardedSignals = []os.Signal{}
+
+// Return the user's command interpreter
+func userShell() string {
+	if shell := os.Getenv("ComSpec"); shell != "" {
+		return shell
+	}
+
+	return "cmd"
+}
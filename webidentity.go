@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// Location of an OIDC token exchanged with AssumeRoleWithWebIdentity
+type webIdentityToken struct {
+	File string
+	Env  string
+}
+
+// Report whether every alias of an account can authenticate with a web
+// identity token
+func usesWebIdentity(account Account) bool {
+	if account.WebIdentityTokenFile != "" || account.WebIdentityTokenEnv != "" {
+		return true
+	}
+
+	for _, alias := range account.Aliases {
+		if alias.WebIdentityTokenFile == "" && alias.WebIdentityTokenEnv == "" {
+			return false
+		}
+	}
+
+	return len(account.Aliases) > 0
+}
+
+// Return the token location for an alias, preferring the alias settings
+// over those of its account
+func aliasWebIdentityToken(alias *Alias, creds *SecurityCredentials) *webIdentityToken {
+	switch {
+	case alias.WebIdentityTokenFile != "" || alias.WebIdentityTokenEnv != "":
+		return &webIdentityToken{File: alias.WebIdentityTokenFile, Env: alias.WebIdentityTokenEnv}
+	case creds.WebIdentityTokenFile != "" || creds.WebIdentityTokenEnv != "":
+		return &webIdentityToken{File: creds.WebIdentityTokenFile, Env: creds.WebIdentityTokenEnv}
+	}
+
+	return nil
+}
+
+// Read the token, which is reread on every call as CI runners rotate it
+func (w *webIdentityToken) Read() (string, error) {
+	var token string
+
+	if w.File != "" {
+		b, err := ioutil.ReadFile(w.File)
+		if err != nil {
+			return "", err
+		}
+		token = string(b)
+	} else {
+		token = os.Getenv(w.Env)
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", fmt.Errorf("web identity token is empty")
+	}
+
+	return token, nil
+}
+
+type assumeRoleWithWebIdentityInput struct {
+	Token       *webIdentityToken `required:"true"`
+	RoleArn     string            `required:"true"`
+	RoleName    string
+	SessionName string
+	Duration    int
+	Policy      string
+	Endpoints   *EndpointConfig
+}
+
+func assumeRoleWithWebIdentity(input assumeRoleWithWebIdentityInput) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	token, err := input.Token.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// The token is the only credential, the request itself is unsigned
+	svc, err := newSTSClient(credentials.AnonymousCredentials, input.Endpoints)
+	if err != nil {
+		return nil, err
+	}
+
+	sessionName := input.SessionName
+	if len(sessionName) == 0 {
+		sessionName, err = generateSessionName(sessionNameInput{Role: input.RoleName})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stsInput := &sts.AssumeRoleWithWebIdentityInput{
+		DurationSeconds:  aws.Int64(int64(input.Duration)),
+		RoleArn:          aws.String(input.RoleArn),
+		RoleSessionName:  aws.String(sessionName),
+		WebIdentityToken: aws.String(token),
+	}
+
+	if input.Policy != "" {
+		stsInput.Policy = aws.String(input.Policy)
+	}
+
+	ctx, cancel := newRequestContext()
+	defer cancel()
+
+	result, err := svc.AssumeRoleWithWebIdentityWithContext(ctx, stsInput)
+	return result, requestError(ctx, err)
+}
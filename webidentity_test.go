@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAssumeRoleWithWebIdentity(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("Action") != "AssumeRoleWithWebIdentity" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		received = r.Form.Get("WebIdentityToken")
+		fmt.Fprintf(w, `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIAEXAMPLE</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "aws-session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	accountFile := filepath.Join(dir, "account-token")
+	aliasFile := filepath.Join(dir, "alias-token")
+	if err := ioutil.WriteFile(accountFile, []byte("account-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(aliasFile, []byte("alias-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	creds := &SecurityCredentials{WebIdentityTokenFile: accountFile}
+	input := assumeRoleWithWebIdentityInput{
+		RoleArn:     "arn:aws:iam::123456789012:role/ci",
+		RoleName:    "ci",
+		SessionName: "ci",
+		Duration:    3600,
+		Endpoints:   &EndpointConfig{STSEndpoint: server.URL},
+	}
+
+	tests := []struct {
+		alias    Alias
+		expected string
+	}{
+		{Alias{Name: "deploy"}, "account-token"},
+		{Alias{Name: "deploy", WebIdentityTokenFile: aliasFile}, "alias-token"},
+	}
+
+	for _, test := range tests {
+		input.Token = aliasWebIdentityToken(&test.alias, creds)
+		result, err := assumeRoleWithWebIdentity(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if received != test.expected || *result.Credentials.AccessKeyId != "ASIAEXAMPLE" {
+			t.Errorf("expected STS to receive %s but got %s", test.expected, received)
+		}
+	}
+
+	// Missing and empty token files fail before calling STS
+	emptyFile := filepath.Join(dir, "empty-token")
+	if err := ioutil.WriteFile(emptyFile, []byte("\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	received = ""
+	input.Token = &webIdentityToken{File: filepath.Join(dir, "missing-token")}
+	if _, err := assumeRoleWithWebIdentity(input); !os.IsNotExist(err) {
+		t.Errorf("expected a missing file error but got %v", err)
+	}
+
+	input.Token = &webIdentityToken{File: emptyFile}
+	if _, err := assumeRoleWithWebIdentity(input); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("expected an empty token error but got %v", err)
+	}
+
+	if received != "" {
+		t.Errorf("expected no request for missing or empty tokens but STS received %q", received)
+	}
+}